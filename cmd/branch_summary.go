@@ -4,297 +4,634 @@ Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
 package cmd
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"github.com/tetran/lgh/internal/cache"
 	"github.com/tetran/lgh/internal/config"
 	"github.com/tetran/lgh/internal/git"
-	"github.com/tetran/lgh/internal/openai"
+	"github.com/tetran/lgh/internal/llm"
+	"github.com/tetran/lgh/internal/locale"
+	"github.com/tetran/lgh/internal/prompt"
+	"github.com/tetran/lgh/internal/tokens"
 )
 
-var (
-	bsCmd = &cobra.Command{
-		Use:   "branch-summary",
-		Short: "Summarize the changes made in the specified branch since the base branch.",
-		Long:  ``,
-		Run:   branchSummary,
-	}
-	system = &openai.Message{
-		Role:    "system",
-		Content: "Act as an expert project manager. Your mission is to make a report on the changes made in the git repository for the client.",
-	}
-)
-
-const (
-	inst_d = `
-	# Instruction:
-	Please summarize the file change briefly, using bullet points and word-for-word descriptions.
-	* Focus on the purpose of the change.
-	* Just return the change of the following file.
-	* Only the filename and brief changes are required.
-	* Preferred language is %s.
-
-	# Expected Output Format:
-	### file.ext (ADD/MOD/DEL)
-	* Add feature X
-	* Change B setting
-	* Fix C bug
-
-	# File change to summarize:
-	%s
-	`
-	inst_c = `
-	# Instruction:
-	Please summarize the git commit briefly, using bullet points and word-for-word descriptions, like release notes.
-	* Focus on the purpose of the commit, ignore the file-level details.
-	* Preferred language is %s.
-
-	# Expected Output Format:
-	* Add feature X to screen A (if the screen name is not clear, assume it based on the file name)
-	* Change B setting from Y to Z
-	* Fix C bug
-
-	# Commit to summarize:
-	%s
-	`
-	inst_b = `
-	# Instruction:
-	Please summarize the changes briefly, using bullet points and word-for-word descriptions, like release notes.
-	* If there are any duplicate or similar commits, combine them, the first one should be the main source.
-	* Combine related items in one section.
-	* Preferred language is %s.
-
-	# Expected Output Format:
-	## Implement feature X
-	* details of the feature and the implementation
-	## Fix C bug
-	* details of the bug and the fix
-
-	# Changes to summarize:
-	%s
-	`
-)
+var bsCmd = &cobra.Command{
+	Use:   "branch-summary",
+	Short: "Summarize the changes made in the specified branch since the base branch.",
+	Long:  ``,
+	Run:   branchSummary,
+}
 
 func init() {
-	bsCmd.Flags().StringP("base", "b", "main", "Base branch")
+	bsCmd.Flags().StringP("base", "b", "", "Base branch (default: base in the config file, or main)")
 	bsCmd.Flags().StringP("target", "t", "", "Target branch")
 	bsCmd.Flags().BoolP("debug", "d", false, "Enable debug mode")
+	bsCmd.Flags().IntP("concurrency", "c", 1, "Number of requests sent to the LLM in parallel")
+	bsCmd.Flags().Int("rpm", 0, "Limit of requests per minute sent to the LLM (0: unlimited)")
+	bsCmd.Flags().Int("tpm", 0, "Limit of tokens per minute sent to the LLM (0: unlimited)")
+	bsCmd.Flags().Bool("no-cache", false, "Summarize every commit again instead of reusing cached summaries")
+	bsCmd.Flags().Bool("resume", false, "Reuse the commit summaries finished by the previous, interrupted run")
+	bsCmd.Flags().Bool("dry-run", false, "Estimate the requests, tokens and cost without calling the API (heuristic token counts, not the model's tokenizer)")
+	bsCmd.Flags().Bool("stream", false, "Print the final summary to the terminal while it is generated")
+	bsCmd.Flags().String("format", formatText, "Output format: text (Markdown) or json")
+	bsCmd.Flags().StringP("output", "o", "", "Also write the result to this file, or to stdout with \"-\"")
+	bsCmd.Flags().String("lang", "", "Output languages, e.g. en,ja; the commits are summarized once in the first (default: lang in the config file)")
+	bsCmd.Flags().Duration("timeout", 0, "Time limit of the whole run, e.g. 30m (0: no limit)")
+	bsCmd.Flags().Duration("request-timeout", 0, "Time limit of each request to the LLM, e.g. 2m (default: depends on the provider)")
 }
 
 func branchSummary(cmd *cobra.Command, args []string) {
-	key := viper.GetString("openai-api-key")
-	if key == "" {
-		fmt.Println("OpenAI API key is required. Please set it in the config file (using `lgh config` command) or pass it via the --openai-api-key flag.")
-		os.Exit(1)
-	}
-	model := viper.GetString("openai-model")
-
 	base, err := cmd.Flags().GetString("base")
 	cobra.CheckErr(err)
 	tgt, err := cmd.Flags().GetString("target")
 	cobra.CheckErr(err)
 	if tgt == "" {
-		fmt.Println("Target branch is required")
+		fmt.Fprintln(os.Stderr, "Target branch is required")
 		os.Exit(1)
 	}
-	debug, err := cmd.Flags().GetBool("debug")
+	stream, err := cmd.Flags().GetBool("stream")
 	cobra.CheckErr(err)
-
-	current, err := os.Getwd()
+	format, err := cmd.Flags().GetString("format")
 	cobra.CheckErr(err)
+	if format != formatText && format != formatJSON {
+		fmt.Fprintf(os.Stderr, "Unknown format: %s\n", format)
+		os.Exit(1)
+	}
+	if stream && format == formatJSON {
+		fmt.Fprintln(os.Stderr, "--stream can't be used with --format json")
+		os.Exit(1)
+	}
 
-	cfg := config.Config{
-		ApiKey: key,
-		Lang:   viper.GetString("lang"),
+	cli, ctx, cancel := newCLI(cmd)
+	defer cancel()
+	if len(cli.langs) > 1 && cli.output == "-" && format == formatJSON {
+		fmt.Fprintln(os.Stderr, "--output - can't be used with --format json and several languages")
+		os.Exit(1)
 	}
-	cli := &cli{
-		repo:   &git.Repository{Path: current},
-		client: &openai.Client{ApiKey: cfg.ApiKey, Model: model, Debug: debug},
-		cfg:    cfg,
-		base:   base,
-		tgt:    tgt,
-		debug:  debug,
+	if base == "" {
+		base = cli.cfg.Base
 	}
-	err = cli.run()
+	if base == "" {
+		base = "main"
+	}
+	cli.base, cli.tgt = base, tgt
+	cli.stream, cli.format = stream, format
+
+	err = cli.run(ctx, "out", cli.summarize)
 	cobra.CheckErr(err)
 }
 
 type cli struct {
 	repo   *git.Repository
-	client *openai.Client
+	client llm.Client
 	cfg    config.Config
 	base   string
 	tgt    string
 	debug  bool
+
+	// langs are the output languages. The map phase runs once in the first, the pivot language
+	// of cfg.Lang, and only the roll-up is made in each.
+	langs []*locale.Locale
+
+	// concurrency is the number of commits and files summarized at the same time.
+	// inflight bounds the requests in flight to the same number, and limiter is shared by all of them.
+	concurrency int
+	limiter     *llm.RateLimiter
+	inflight    chan struct{}
+
+	// cache keeps the per-file and per-commit summaries across runs.
+	// With noCache it is only written, so the summaries are made again and refreshed.
+	cache   *cache.Cache
+	noCache bool
+
+	// resume keeps the output directory of the previous run and reuses its finished commits.
+	resume bool
+	dryRun bool
+	// stream prints the final roll-up while it is generated.
+	stream bool
+	// format is formatText or formatJSON, formatPR for pr-description or formatRelease for release-notes.
+	format string
+	// prTemplate is the pull request template which the description fills in, if any.
+	prTemplate string
+	// output is where the result is copied besides the work directory: a file, "-" for stdout, or none.
+	output string
+
+	prompts  *prompt.Set
+	progress *progress
+
+	mu    sync.Mutex
+	usage llm.Usage
+	// skipped counts the files whose content was not sent in full.
+	skipped int
 }
 
-func (c *cli) run() error {
-	if !c.repo.IsGitRepository() {
-		return fmt.Errorf("not a git repository")
+// newCLI sets up a run of the command from its flags and the config: the output languages,
+// the LLM client and the limits of the requests. Flags which the command doesn't have are left at
+// their zero values. The returned context ends at --timeout.
+func newCLI(cmd *cobra.Command) (*cli, context.Context, context.CancelFunc) {
+	debug := boolFlag(cmd, "debug")
+	concurrency := max(intFlag(cmd, "concurrency"), 1)
+	dryRun := boolFlag(cmd, "dry-run")
+	timeout := durationFlag(cmd, "timeout")
+	requestTimeout := durationFlag(cmd, "request-timeout")
+	cacheDir, err := config.CacheDir()
+	cobra.CheckErr(err)
+	current, err := os.Getwd()
+	cobra.CheckErr(err)
+
+	cfg := loadConfig()
+	lang := stringFlag(cmd, "lang")
+	if lang == "" {
+		lang = cfg.Lang
+	}
+	if lang == "" {
+		lang = locale.Default
+	}
+	// An unknown language would quietly give summaries in English.
+	langs, err := locale.ParseList(lang)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// The commits are summarized in the pivot language, the first one.
+	cfg.Lang = langs[0].Tag
+	if requestTimeout > 0 {
+		cfg.RequestTimeout = requestTimeout
 	}
+	var client llm.Client
+	// A dry run sends nothing, so it works without credentials.
+	if !dryRun {
+		client, err = newClient(cmd.Context(), cfg, debug)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	c := &cli{
+		repo:   &git.Repository{Path: current},
+		client: client,
+		cfg:    cfg,
+		debug:  debug,
+		langs:  langs,
 
-	home, err := os.UserHomeDir()
+		concurrency: concurrency,
+		limiter:     &llm.RateLimiter{RequestsPerMinute: intFlag(cmd, "rpm"), TokensPerMinute: intFlag(cmd, "tpm")},
+		inflight:    make(chan struct{}, concurrency),
+
+		cache:   &cache.Cache{Dir: cacheDir},
+		noCache: boolFlag(cmd, "no-cache"),
+		resume:  boolFlag(cmd, "resume"),
+		dryRun:  dryRun,
+		output:  stringFlag(cmd, "output"),
+	}
+
+	ctx, cancel := cmd.Context(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	return c, ctx, cancel
+}
+
+func boolFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) == nil {
+		return false
+	}
+	v, err := cmd.Flags().GetBool(name)
+	cobra.CheckErr(err)
+	return v
+}
+
+func intFlag(cmd *cobra.Command, name string) int {
+	if cmd.Flags().Lookup(name) == nil {
+		return 0
+	}
+	v, err := cmd.Flags().GetInt(name)
+	cobra.CheckErr(err)
+	return v
+}
+
+func stringFlag(cmd *cobra.Command, name string) string {
+	if cmd.Flags().Lookup(name) == nil {
+		return ""
+	}
+	v, err := cmd.Flags().GetString(name)
+	cobra.CheckErr(err)
+	return v
+}
+
+func durationFlag(cmd *cobra.Command, name string) time.Duration {
+	if cmd.Flags().Lookup(name) == nil {
+		return 0
+	}
+	v, err := cmd.Flags().GetDuration(name)
+	cobra.CheckErr(err)
+	return v
+}
+
+// run summarizes the commits with finish, which makes the final document from them.
+// The intermediate files are kept in the directory named dir of the work directory of the repository.
+func (c *cli) run(ctx context.Context, dir string, finish func(ctx context.Context, outdir string) error) error {
+	top, err := c.loadPrompts(ctx)
 	if err != nil {
 		return err
 	}
 
-	work := filepath.Join(home, config.WorkDir, "tmp", filepath.Base(c.repo.Path))
-	err = os.RemoveAll(work)
+	if c.dryRun {
+		est, err := c.estimate(ctx)
+		if err != nil {
+			return err
+		}
+		c.printEstimate(est)
+		return nil
+	}
+
+	home, err := os.UserHomeDir()
 	if err != nil {
 		return err
 	}
 
-	outdir := filepath.Join(work, "out")
+	outdir := filepath.Join(home, config.WorkDir, "tmp", workName(top), dir)
+	if !c.resume {
+		err = os.RemoveAll(outdir)
+		if err != nil {
+			return err
+		}
+	}
 	err = os.MkdirAll(outdir, 0700)
 	if err != nil {
 		return err
 	}
 
-	err = c.summarize(outdir)
+	err = finish(ctx, outdir)
+	if c.usage.Total() > 0 || err == nil {
+		fmt.Fprintf(os.Stderr, "[Token usage] %d (prompt: %d, completion: %d)\n", c.usage.Total(), c.usage.PromptTokens, c.usage.CompletionTokens)
+	}
 	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "[Interrupted] The finished commits are kept in %s. Run again with --resume to continue.\n", outdir)
+		}
 		return err
 	}
 
 	return nil
 }
 
-func (c *cli) commitText(commit git.Commit) (string, []string, error) {
-	info := fmt.Sprintf("## Message\n%s\n## All change list:\n", strings.TrimSpace(commit.Message))
-	bodies := make([]string, 0, len(commit.Diffs))
-	for _, diff := range commit.Diffs {
-		dcs := make([]string, 0, len(diff.DiffContents))
-		st := "MOD"
-		var bytes int
-		for _, dc := range diff.DiffContents {
-			if strings.HasPrefix(dc, "new file mode ") {
-				st = "ADD"
-			} else if strings.HasPrefix(dc, "deleted file mode ") {
-				st = "DEL"
-			} else if strings.HasPrefix(dc, "Binary files ") || strings.HasSuffix(diff.Path, ".svg") {
-				// skip binary files
-			} else {
-				// Limit the size of the diff contents to 40KB because of the token limit.
-				if bytes+len(dc) > 40*1024 {
-					break
-				}
-				dcs = append(dcs, strings.TrimSpace(dc))
-				bytes += len(dc)
-			}
-		}
-		b := fmt.Sprintf("### File: %s\n", diff.Path)
-		if len(dcs) > 0 {
-			b += "```\n" + strings.Join(dcs, "\n") + "\n```\n"
-		}
-		bodies = append(bodies, b)
-		info += fmt.Sprintf("%s %s\n", st, diff.Path)
+// loadPrompts loads the prompt templates in effect in the repository and returns the root of its working tree.
+func (c *cli) loadPrompts(ctx context.Context) (string, error) {
+	if !c.repo.IsGitRepository(ctx) {
+		return "", fmt.Errorf("not a git repository")
 	}
-
-	return info, bodies, nil
+	top, err := c.repo.TopLevel(ctx)
+	if err != nil {
+		return "", err
+	}
+	dirs, err := config.PromptDirs(top, c.cfg.PromptDir)
+	if err != nil {
+		return "", err
+	}
+	if c.prompts, err = prompt.Load(dirs...); err != nil {
+		return "", err
+	}
+	return top, nil
 }
 
-func (c *cli) summarize(outdir string) error {
-	commits, err := c.repo.CommitsOnBranch(c.tgt, c.base)
+// summarize makes the summary of the branch in each output language.
+func (c *cli) summarize(ctx context.Context, outdir string) error {
+	commits, summaries, allSummaries, err := c.summarizeCommits(ctx, outdir)
 	if err != nil {
 		return err
 	}
-	num := len(commits)
-	fmt.Printf("[Commits] %d\n", num)
-
-	prompt, completion := 0, 0
-	defer func() {
-		fmt.Printf("[Token usage] %d (prompt: %d, completion: %d)\n", prompt+completion, prompt, completion)
-	}()
-	var allSummaries string
-	for i, commit := range commits {
-		if commit.IsMerge {
-			if err = c.saveFile(
-				filepath.Join(outdir, fmt.Sprintf("CS%05d", num-i)),
-				fmt.Sprintf("* Merged: %s", commit.Message)); err != nil {
-				return err
-			}
-			fmt.Print(".")
-			continue
-		}
 
-		info, bodies, err := c.commitText(commit)
+	for _, lang := range c.langs {
+		if len(c.langs) > 1 {
+			fmt.Fprintf(os.Stderr, "[Language] %s\n", lang.Tag)
+		}
+		var content string
+		if c.format == formatJSON {
+			content, err = c.jsonSummary(ctx, lang, commits, summaries, allSummaries)
+		} else {
+			content, err = c.textSummary(ctx, lang, allSummaries)
+		}
 		if err != nil {
 			return err
 		}
 
-		logs := fmt.Sprintf("%s\n## Change details:\n", info)
-		sps := []*openai.Message{
-			system, {
-				Role:    "system",
-				Content: fmt.Sprintf("Below is the overview of this entire commit. Take it into account as needed:\n%s", info),
-			},
+		path := filepath.Join(outdir, c.resultName(lang))
+		if err = c.saveFile(path, content); err != nil {
+			return err
 		}
-		for _, body := range bodies {
-			messages := append(sps, &openai.Message{
-				Role:    "user",
-				Content: fmt.Sprintf(inst_d, c.cfg.FullLang(), body),
-			})
-			res, err := c.client.Chat(messages)
-			if err != nil {
-				return err
-			}
+		output := c.outputPath(lang)
+		if err = c.writeOutput(output, content); err != nil {
+			return err
+		}
+		if output != "" && output != "-" {
+			path = output
+		}
+		fmt.Fprintf(os.Stderr, "[Result file] %s\n", path)
+	}
+	if c.skipped > 0 {
+		fmt.Fprintf(os.Stderr, "[Skipped] %d files were not sent in full (binary or too large); see the notes in the CL files\n", c.skipped)
+	}
+	return nil
+}
+
+// summarizeCommits summarizes the commits of the branch and reduces the summaries until they fit in
+// the final request. It returns the commits, their summaries, empty for merges, and the reduced summaries.
+func (c *cli) summarizeCommits(ctx context.Context, outdir string) ([]git.Commit, []string, string, error) {
+	commits, err := c.commits(ctx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	num := len(commits)
+	fmt.Fprintf(os.Stderr, "[Commits] %d\n", num)
 
-			prompt += res.Usage.PromptTokens
-			completion += res.Usage.CompletionTokens
+	var prev *runManifest
+	if c.resume {
+		if prev, err = loadRunManifest(outdir); err != nil {
+			return nil, nil, "", err
+		}
+		if prev.Base != c.base || prev.Target != c.tgt {
+			return nil, nil, "", fmt.Errorf("the previous run summarized `%s` against `%s`; run without --resume", prev.Target, prev.Base)
+		}
+	}
 
-			logs += res.Choices[0].Message.Content + "\n"
+	// Commits are summarized in parallel, but the summaries are combined in commit order.
+	manifest := newRunManifest(c.base, c.tgt, num)
+	summaries := make([]string, num)
+	done := make([]bool, num)
+	resumed := 0
+	if prev != nil {
+		for i, commit := range commits {
+			if sum, ok := prev.finished(outdir, num-i, commit); ok {
+				if !commit.IsMerge {
+					summaries[i] = sum
+				}
+				done[i] = true
+				manifest.Commits[num-i-1] = commit.Hash
+				resumed++
+			}
 		}
+		fmt.Fprintf(os.Stderr, "[Resumed] %d of %d commits were already summarized\n", resumed, num)
+	}
+	if err = manifest.save(outdir); err != nil {
+		return nil, nil, "", err
+	}
 
-		if err = c.saveFile(filepath.Join(outdir, fmt.Sprintf("CL%05d", num-i)), logs); err != nil {
-			return err
+	c.progress = newProgress(os.Stderr, resumed, num, c.totalTokens)
+	defer c.progress.finish()
+	err = parallel(ctx, num, c.concurrency, func(ctx context.Context, i int) error {
+		if done[i] {
+			return nil
 		}
-		sum, err := c.sumCommit(logs, outdir, num-i)
+		sum, err := c.sumCommit(ctx, commits[i], outdir, num-i)
 		if err != nil {
 			return err
 		}
+		if err = manifest.done(outdir, num-i, commits[i]); err != nil {
+			return err
+		}
+		summaries[i] = sum
+		c.progress.commitDone()
+		return nil
+	})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	allSummaries, err := c.reduce(ctx, outdir, c.changes(commits, summaries))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	c.progress.finish()
+	return commits, summaries, allSummaries, nil
+}
 
-		allSummaries += sum
-		fmt.Print(".")
+// textSummary makes the final summary in Markdown, in the language.
+func (c *cli) textSummary(ctx context.Context, lang *locale.Locale, summaries string) (string, error) {
+	messages, err := c.branchMessages(lang, summaries)
+	if err != nil {
+		return "", err
+	}
+	var res *llm.Response
+	if c.stream {
+		res, err = c.chatStream(ctx, messages, func(s string) { fmt.Print(s) })
+		fmt.Println()
+	} else {
+		res, err = c.chat(ctx, messages)
+	}
+	if err != nil {
+		return "", err
 	}
+	return res.Content, nil
+}
 
-	messages := []*openai.Message{
-		system, {
-			Role:    "user",
-			Content: fmt.Sprintf(inst_b, c.cfg.FullLang(), allSummaries),
-		},
+// jsonSummary makes the final summary as sections, in the language, and returns the JSON document of the whole run.
+// The commit and file summaries are in the pivot language.
+func (c *cli) jsonSummary(ctx context.Context, lang *locale.Locale, commits []git.Commit, summaries []string, rollup string) (string, error) {
+	sections, err := c.rollupSections(ctx, lang, rollup)
+	if err != nil {
+		return "", err
 	}
-	res, err := c.client.Chat(messages)
+	rep, err := c.branchReport(ctx, commits, summaries, sections)
 	if err != nil {
-		return err
+		return "", err
+	}
+	b, err := rep.Marshal()
+	if err != nil {
+		return "", err
 	}
-	prompt += res.Usage.PromptTokens
-	completion += res.Usage.CompletionTokens
+	return string(b), nil
+}
 
-	path := filepath.Join(outdir, "summary.txt")
-	if err = c.saveFile(
-		path,
-		res.Choices[0].Message.Content); err != nil {
+// resultName names the result file in the work directory. With several languages,
+// each has its own file, e.g. summary.ja.md.
+func (c *cli) resultName(lang *locale.Locale) string {
+	ext := ".txt"
+	if c.format == formatJSON {
+		ext = ".json"
+	}
+	if len(c.langs) == 1 {
+		return "summary" + ext
+	}
+	if ext == ".txt" {
+		ext = ".md"
+	}
+	return "summary." + lang.Tag + ext
+}
+
+// outputPath returns the --output destination of the result in the language.
+// With several languages, the tag is added before the extension of the file: notes.md gives notes.ja.md.
+func (c *cli) outputPath(lang *locale.Locale) string {
+	if len(c.langs) == 1 || c.output == "" || c.output == "-" {
+		return c.output
+	}
+	ext := filepath.Ext(c.output)
+	return strings.TrimSuffix(c.output, ext) + "." + lang.Tag + ext
+}
+
+// writeOutput copies the result to the output destination.
+// With --stream the text has already been printed while it was generated.
+func (c *cli) writeOutput(output, content string) error {
+	switch output {
+	case "":
+		return nil
+	case "-":
+		if c.stream {
+			return nil
+		}
+		_, err := fmt.Println(strings.TrimSuffix(content, "\n"))
 		return err
 	}
-	fmt.Printf("\n[Result file] %s\n", path)
-	return nil
+	return os.WriteFile(output, []byte(content), 0644)
 }
 
-func (c *cli) sumCommit(logs, dir string, fnum int) (string, error) {
-	messages := []*openai.Message{
-		system, {
-			Role:    "user",
-			Content: fmt.Sprintf(inst_c, c.cfg.FullLang(), logs),
-		},
+// workName names the work directory of the repository. The base name keeps it recognizable,
+// and the hash of the path keeps repositories of the same name apart.
+func workName(top string) string {
+	sum := sha256.Sum256([]byte(top))
+	return fmt.Sprintf("%s-%x", filepath.Base(top), sum[:4])
+}
+
+// commits returns the commits on the target branch, without the changes of excluded paths.
+// For release notes, they are the commits of the range base..tgt, each merge followed by the commits it brought in.
+func (c *cli) commits(ctx context.Context) ([]git.Commit, error) {
+	var commits []git.Commit
+	var err error
+	if c.format == formatRelease {
+		commits, err = c.repo.CommitsInRange(ctx, c.base, c.tgt)
+		commits = withMerged(commits)
+	} else {
+		commits, err = c.repo.CommitsOnBranch(ctx, c.tgt, c.base)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range commits {
+		commits[i].Diffs = c.included(commits[i].Diffs)
+	}
+	return commits, nil
+}
+
+// withMerged returns the commits, each merge followed by the commits it brought in.
+func withMerged(commits []git.Commit) []git.Commit {
+	ret := make([]git.Commit, 0, len(commits))
+	for _, commit := range commits {
+		ret = append(ret, commit)
+		ret = append(ret, commit.Merged...)
+	}
+	return ret
+}
+
+// changes returns the summaries to roll up, in commit order, leaving out merges.
+// For release notes, each starts with the subject of its commit, which tells the kind of change in
+// Conventional Commits, and the commits brought in by a merge are grouped under it as one pull request.
+func (c *cli) changes(commits []git.Commit, summaries []string) []string {
+	if c.format != formatRelease {
+		return nonEmpty(summaries)
 	}
-	res, err := c.client.Chat(messages)
+	var ret []string
+	for i := 0; i < len(commits); i++ {
+		commit := commits[i]
+		if !commit.IsMerge {
+			if summaries[i] != "" {
+				ret = append(ret, fmt.Sprintf("# Commit: %s\n%s", commit.Subject(), summaries[i]))
+			}
+			continue
+		}
+		if len(commit.Merged) == 0 {
+			continue
+		}
+		change := fmt.Sprintf("# Pull request: %s\n", strings.TrimSpace(unindent(commit.Message)))
+		for j := range commit.Merged {
+			change += fmt.Sprintf("## Commit: %s\n%s", commits[i+1+j].Subject(), summaries[i+1+j])
+		}
+		ret = append(ret, change)
+		i += len(commit.Merged)
+	}
+	return ret
+}
+
+// unindent removes the indentation of git log from the lines of a commit message.
+func unindent(message string) string {
+	lines := strings.Split(message, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// included returns the changes of the paths which are not excluded by the config.
+func (c *cli) included(diffs []git.FileDiff) []git.FileDiff {
+	if len(c.cfg.Exclude) == 0 {
+		return diffs
+	}
+	ret := diffs[:0:0]
+	for _, diff := range diffs {
+		if !git.MatchAny(c.cfg.Exclude, diff.Path) {
+			ret = append(ret, diff)
+		}
+	}
+	return ret
+}
+
+func nonEmpty(values []string) []string {
+	ret := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// sumCommit summarizes each file of the commit and then the commit itself.
+// The file summaries are saved as CL<fnum> and the commit summary as CS<fnum>.
+func (c *cli) sumCommit(ctx context.Context, commit git.Commit, dir string, fnum int) (string, error) {
+	if commit.IsMerge {
+		err := c.saveFile(
+			filepath.Join(dir, fmt.Sprintf("CS%05d", fnum)),
+			fmt.Sprintf("* Merged: %s", commit.Message))
+		return "", err
+	}
+
+	info, bodies, err := c.commitText(commit)
+	if err != nil {
+		return "", err
+	}
+	c.progress.commitStarted(commit, len(bodies))
+	cd := commitData(commit, bodies)
+	fileSums, err := c.sumFiles(ctx, commit, cd, info, bodies)
+	if err != nil {
+		return "", err
+	}
+
+	logs := fmt.Sprintf("%s\n## Change details:\n%s", info, strings.Join(fileSums, ""))
+	if err = c.saveFile(filepath.Join(dir, fmt.Sprintf("CL%05d", fnum)), logs); err != nil {
+		return "", err
+	}
+
+	content, err := c.cached(c.commitKey(commit), func() (string, error) {
+		messages, err := c.commitMessages(cd, logs)
+		if err != nil {
+			return "", err
+		}
+		res, err := c.chat(ctx, messages)
+		if err != nil {
+			return "", err
+		}
+		return res.Content + "\n", nil
+	})
 	if err != nil {
 		return "", err
 	}
-	content := res.Choices[0].Message.Content + "\n"
 
 	path := filepath.Join(dir, fmt.Sprintf("CS%05d", fnum))
 	if err = c.saveFile(path, content); err != nil {
@@ -304,46 +641,184 @@ func (c *cli) sumCommit(logs, dir string, fnum int) (string, error) {
 	return content, nil
 }
 
-func (c *cli) saveFile(path, content string) error {
-	file, err := os.Create(path)
+// sumFiles summarizes the file changes of the commit in parallel, and sets the summaries on the bodies
+// so that the commit prompt sees them. The summaries are returned in the order of the diffs.
+func (c *cli) sumFiles(ctx context.Context, commit git.Commit, cd *prompt.CommitData, info string, bodies []fileBody) ([]string, error) {
+	fileSums := make([]string, len(bodies))
+	err := parallel(ctx, len(bodies), c.concurrency, func(ctx context.Context, i int) error {
+		key := c.fileKey(commit, commit.Diffs[i])
+		sum, err := c.cached(key, func() (string, error) {
+			return c.sumFile(ctx, key, cd, info, bodies[i])
+		})
+		if err != nil {
+			return err
+		}
+		if bodies[i].skipped != "" {
+			sum += fmt.Sprintf("* (Not shown to the model: %s)\n", bodies[i].skipped)
+			c.mu.Lock()
+			c.skipped++
+			c.mu.Unlock()
+		}
+		fileSums[i] = sum
+		bodies[i].file.Summary = strings.TrimSpace(sum)
+		c.progress.fileDone(commit)
+		return nil
+	})
 	if err != nil {
+		return nil, err
+	}
+	return fileSums, nil
+}
+
+// sumFile summarizes one file change. A change split into several chunks is summarized
+// chunk by chunk, and the chunk summaries are then merged into one file summary.
+func (c *cli) sumFile(ctx context.Context, key string, cd *prompt.CommitData, info string, body fileBody) (string, error) {
+	if len(body.chunks) == 1 {
+		messages, err := c.fileMessages(cd, body.file, info, body.chunks[0])
+		if err != nil {
+			return "", err
+		}
+		res, err := c.chat(ctx, messages)
+		if err != nil {
+			return "", err
+		}
+		return res.Content + "\n", nil
+	}
+
+	parts := make([]string, len(body.chunks))
+	err := parallel(ctx, len(body.chunks), c.concurrency, func(ctx context.Context, i int) error {
+		part, err := c.cached(cache.Key(key, "chunk", strconv.Itoa(i)), func() (string, error) {
+			messages, err := c.fileMessages(cd, body.file, info, body.chunks[i])
+			if err != nil {
+				return "", err
+			}
+			res, err := c.chat(ctx, messages)
+			if err != nil {
+				return "", err
+			}
+			return res.Content + "\n", nil
+		})
+		parts[i] = part
 		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	messages, err := c.mergeMessages(cd, body.file, strings.Join(parts, "\n"))
+	if err != nil {
+		return "", err
+	}
+	res, err := c.chat(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	return res.Content + "\n", nil
+}
+
+// cacheKey builds the key of a cached summary. Besides the given parts, it includes everything
+// that changes the output for the same input: the provider, the model, the language and the prompt templates.
+func (c *cli) cacheKey(kind string, parts ...string) string {
+	return cache.Key(append([]string{kind, c.cfg.Provider, c.cfg.Model, c.cfg.FullLang(), c.prompts.Version()}, parts...)...)
+}
+
+// commitKey is the cache key of the summary of a commit. The summarized files are part of it,
+// since excluding files changes the summary.
+func (c *cli) commitKey(commit git.Commit) string {
+	parts := []string{commit.Hash}
+	for _, diff := range commit.Diffs {
+		parts = append(parts, diff.Path)
+	}
+	return c.cacheKey("commit", parts...)
+}
+
+// fileKey is the cache key of the summary of one file change.
+func (c *cli) fileKey(commit git.Commit, diff git.FileDiff) string {
+	return c.cacheKey("file", commit.Hash, diff.Path, diff.IndexBefore, diff.IndexAfter)
+}
+
+// cached returns the cached content of the key, or makes it with fn and caches it.
+func (c *cli) cached(key string, fn func() (string, error)) (string, error) {
+	if !c.noCache {
+		if content, ok := c.cache.Get(key); ok {
+			return content, nil
+		}
+	}
+	content, err := fn()
+	if err != nil {
+		return "", err
+	}
+	if err = c.cache.Put(key, content); err != nil {
+		return "", err
+	}
+	return content, nil
+}
+
+// chat sends the messages to the configured provider and adds the token usage to the running total.
+// It is safe for concurrent use; requests beyond the concurrency and rate limits wait their turn.
+func (c *cli) chat(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+	return c.send(ctx, messages, c.client.Chat)
+}
+
+// chatStream is chat, calling onDelta with the answer as it is generated.
+// Providers which can't stream get the whole answer at once.
+func (c *cli) chatStream(ctx context.Context, messages []*llm.Message, onDelta func(string)) (*llm.Response, error) {
+	s, ok := c.client.(llm.Streamer)
+	if !ok {
+		res, err := c.chat(ctx, messages)
+		if err == nil {
+			onDelta(res.Content)
+		}
+		return res, err
+	}
+	return c.send(ctx, messages, func(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+		return s.ChatStream(ctx, messages, onDelta)
+	})
+}
+
+func (c *cli) send(
+	ctx context.Context,
+	messages []*llm.Message,
+	fn func(context.Context, []*llm.Message) (*llm.Response, error),
+) (*llm.Response, error) {
+	estimated := promptTokens(tokens.ForModel(c.cfg.Model), messages)
+	if err := c.limiter.Wait(ctx, estimated); err != nil {
+		return nil, err
+	}
+
+	select {
+	case c.inflight <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	defer file.Close()
-	_, err = file.WriteString(content)
+	res, err := fn(ctx, messages)
+	<-c.inflight
 	if err != nil {
+		return nil, err
+	}
+
+	c.limiter.Adjust(estimated, res.Usage.Total())
+	c.mu.Lock()
+	c.usage.PromptTokens += res.Usage.PromptTokens
+	c.usage.CompletionTokens += res.Usage.CompletionTokens
+	c.mu.Unlock()
+	return res, nil
+}
+
+func (c *cli) totalTokens() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage.Total()
+}
+
+func (c *cli) saveFile(path, content string) error {
+	if err := writeFileAtomic(path, content); err != nil {
 		return err
 	}
 
 	if c.debug {
-		fmt.Printf("\n## Saved file\n%s\n", path)
+		fmt.Fprintf(os.Stderr, "\n## Saved file\n%s\n", path)
 	}
 
 	return nil
 }
-
-// func (c *cli) read(path string) (string, error) {
-// 	file, err := os.Open(path)
-// 	if err != nil {
-// 		return "", err
-// 	}
-// 	defer file.Close()
-
-// 	scanner := bufio.NewScanner(file)
-// 	buf := make([]byte, 10000)
-// 	scanner.Buffer(buf, 1000000)
-// 	var lines []string
-// 	var totalBytes int
-// 	for scanner.Scan() {
-// 		totalBytes += len(scanner.Bytes())
-// 		if totalBytes > 40*1024 {
-// 			break
-// 		}
-// 		lines = append(lines, scanner.Text())
-// 	}
-// 	if err := scanner.Err(); err != nil {
-// 		return "", err
-// 	}
-
-// 	return strings.Join(lines, "\n"), nil
-// }
@@ -0,0 +1,50 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tetran/lgh/internal/cache"
+	"github.com/tetran/lgh/internal/config"
+)
+
+var (
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the summary cache",
+		Long:  `Manage the cache of per-file and per-commit summaries reused by branch-summary.`,
+	}
+	cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached summaries which have not been used recently",
+		Run:   cachePrune,
+	}
+)
+
+func init() {
+	cachePruneCmd.Flags().Duration("older-than", 30*24*time.Hour, "Remove entries not used for longer than this")
+	cachePruneCmd.Flags().Bool("all", false, "Remove all entries")
+	cacheCmd.AddCommand(cachePruneCmd)
+}
+
+func cachePrune(cmd *cobra.Command, args []string) {
+	olderThan, err := cmd.Flags().GetDuration("older-than")
+	cobra.CheckErr(err)
+	all, err := cmd.Flags().GetBool("all")
+	cobra.CheckErr(err)
+	if all {
+		olderThan = 0
+	}
+
+	dir, err := config.CacheDir()
+	cobra.CheckErr(err)
+
+	c := &cache.Cache{Dir: dir}
+	n, err := c.Prune(olderThan)
+	cobra.CheckErr(err)
+	fmt.Printf("Removed %d cached entries from %s\n", n, dir)
+}
@@ -0,0 +1,202 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/prompt"
+	"github.com/tetran/lgh/internal/tokens"
+)
+
+const (
+	// minChunkTokens keeps chunks useful even when the commit overview fills most of the context window.
+	minChunkTokens = 512
+	// maxChunksPerFile bounds the cost of huge (often generated) files. The remaining hunks are skipped.
+	maxChunksPerFile = 8
+)
+
+// fileBody is the text of one file change sent to the model,
+// split along hunk boundaries into chunks that fit in the context window.
+type fileBody struct {
+	file   *prompt.FileData
+	chunks []string
+	// skipped describes the content which was not sent, if any.
+	skipped string
+}
+
+func (c *cli) commitText(commit git.Commit) (string, []fileBody, error) {
+	// Staged changes have no message yet.
+	info := "## All change list:\n"
+	if msg := strings.TrimSpace(commit.Message); msg != "" {
+		info = fmt.Sprintf("## Message\n%s\n%s", msg, info)
+	}
+	for _, diff := range commit.Diffs {
+		info += fmt.Sprintf("%s %s\n", fileStatus(diff), diff.Path)
+	}
+
+	budget := c.chunkBudget(info)
+	bodies := make([]fileBody, 0, len(commit.Diffs))
+	for _, diff := range commit.Diffs {
+		body := c.splitDiff(diff, budget)
+		body.file = &prompt.FileData{Path: diff.Path, Status: fileStatus(diff)}
+		bodies = append(bodies, body)
+	}
+
+	return info, bodies, nil
+}
+
+func fileStatus(diff git.FileDiff) string {
+	for _, dc := range diff.DiffContents {
+		if strings.HasPrefix(dc, "new file mode ") {
+			return "ADD"
+		} else if strings.HasPrefix(dc, "deleted file mode ") {
+			return "DEL"
+		}
+	}
+	return "MOD"
+}
+
+func isBinary(diff git.FileDiff) bool {
+	if strings.HasSuffix(diff.Path, ".svg") {
+		return true
+	}
+	for _, dc := range diff.DiffContents {
+		if strings.HasPrefix(dc, "Binary files ") {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkBudget returns how many tokens of diff are sent in one request: half of the model's
+// context window, leaving the rest for the instructions and the answer, minus the commit
+// overview which is sent along with every chunk.
+func (c *cli) chunkBudget(info string) int {
+	window := tokens.Lookup(c.cfg.Model).ContextWindow
+	return max(window/2-tokens.ForModel(c.cfg.Model).Count(info), minChunkTokens)
+}
+
+func (c *cli) splitDiff(diff git.FileDiff, budget int) fileBody {
+	title := fmt.Sprintf("### File: %s", diff.Path)
+	if isBinary(diff) {
+		return fileBody{chunks: []string{title + "\n"}, skipped: "binary content"}
+	}
+
+	tok := tokens.ForModel(c.cfg.Model)
+	count := func(lines []string) int {
+		n := 0
+		for _, l := range lines {
+			n += tok.Count(l) + 1
+		}
+		return n
+	}
+
+	header, hunks := diff.Hunks()
+	var lines []string
+	for _, h := range header {
+		if !strings.HasPrefix(h, "new file mode ") && !strings.HasPrefix(h, "deleted file mode ") {
+			lines = append(lines, strings.TrimSpace(h))
+		}
+	}
+
+	var (
+		chunks      [][]string
+		size        = count(lines)
+		skipped     int
+		skippedLine int
+	)
+	for _, hunk := range hunks {
+		if len(chunks) == maxChunksPerFile {
+			skipped++
+			skippedLine += len(hunk)
+			continue
+		}
+		pieces := splitHunk(hunk, budget, count)
+		for i, piece := range pieces {
+			n := count(piece)
+			if len(lines) > 0 && size+n > budget {
+				chunks = append(chunks, lines)
+				lines, size = nil, 0
+				if len(chunks) == maxChunksPerFile {
+					skipped++
+					skippedLine += droppedLines(pieces[i:], i > 0)
+					break
+				}
+			}
+			lines = append(lines, piece...)
+			size += n
+		}
+	}
+	if len(lines) > 0 {
+		chunks = append(chunks, lines)
+	}
+
+	body := fileBody{}
+	if skipped > 0 {
+		body.skipped = fmt.Sprintf("%s (%s) beyond %s", plural(skipped, "hunk"), plural(skippedLine, "line"), plural(maxChunksPerFile, "chunk"))
+	}
+	if len(chunks) == 0 {
+		body.chunks = []string{title + "\n"}
+		return body
+	}
+	for i, chunk := range chunks {
+		t := title
+		if len(chunks) > 1 {
+			t += fmt.Sprintf(" (part %d/%d)", i+1, len(chunks))
+		}
+		body.chunks = append(body.chunks, t+"\n```\n"+strings.Join(chunk, "\n")+"\n```\n")
+	}
+	return body
+}
+
+// droppedLines counts the lines of the hunk in the pieces which are not sent. The `@@` line
+// repeated at the start of the pieces after the first one is not a line of the hunk.
+func droppedLines(pieces [][]string, continued bool) int {
+	n := 0
+	for i, piece := range pieces {
+		n += len(piece)
+		if i > 0 || continued {
+			n--
+		}
+	}
+	return n
+}
+
+// splitHunk splits a hunk which alone exceeds the budget into pieces at line boundaries.
+// Each piece repeats the `@@` line so that the model knows where it is.
+func splitHunk(hunk []string, budget int, count func([]string) int) [][]string {
+	lines := make([]string, len(hunk))
+	for i, l := range hunk {
+		lines[i] = strings.TrimSpace(l)
+	}
+	if count(lines) <= budget {
+		return [][]string{lines}
+	}
+
+	var pieces [][]string
+	piece := []string{lines[0]}
+	size := count(piece)
+	for _, l := range lines[1:] {
+		n := count([]string{l})
+		if len(piece) > 1 && size+n > budget {
+			pieces = append(pieces, piece)
+			piece = []string{lines[0] + " (continued)"}
+			size = count(piece)
+		}
+		piece = append(piece, l)
+		size += n
+	}
+	return append(pieces, piece)
+}
+
+// plural returns the count with the noun, adding an s unless the count is one.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
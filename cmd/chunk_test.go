@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tetran/lgh/internal/config"
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/tokens"
+)
+
+const chunkTestModel = "gpt-4"
+
+// lineCount counts the lines as splitDiff does.
+func lineCount(lines []string) int {
+	tok := tokens.ForModel(chunkTestModel)
+	n := 0
+	for _, l := range lines {
+		n += tok.Count(l) + 1
+	}
+	return n
+}
+
+// testHunk returns a hunk of n added lines.
+func testHunk(n int) []string {
+	hunk := []string{fmt.Sprintf("@@ -1,0 +1,%d @@", n)}
+	for i := 0; i < n; i++ {
+		hunk = append(hunk, "+x")
+	}
+	return hunk
+}
+
+func testDiff(hunks ...[]string) git.FileDiff {
+	diff := git.FileDiff{Path: "main.go"}
+	for _, h := range hunks {
+		diff.DiffContents = append(diff.DiffContents, h...)
+	}
+	return diff
+}
+
+// budgetFor returns the budget in which a hunk of n lines exactly fits.
+func budgetFor(n int) int {
+	return lineCount(testHunk(n))
+}
+
+func TestSplitHunk(t *testing.T) {
+	count := func(lines []string) int { return len(lines) }
+	tests := []struct {
+		name   string
+		hunk   []string
+		budget int
+		want   [][]string
+	}{
+		{"fits", []string{"@@", "a", "b"}, 4, [][]string{{"@@", "a", "b"}}},
+		{"split", []string{"@@", "a", "b", "c", "d", "e"}, 4,
+			[][]string{{"@@", "a", "b", "c"}, {"@@ (continued)", "d", "e"}}},
+		{"line larger than the budget", []string{"@@", "a", "b"}, 1,
+			[][]string{{"@@", "a"}, {"@@ (continued)", "b"}}},
+		{"trimmed", []string{"@@ ", " a "}, 4, [][]string{{"@@", "a"}}},
+	}
+	for _, tt := range tests {
+		if got := splitHunk(tt.hunk, tt.budget, count); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitDiff(t *testing.T) {
+	c := &cli{cfg: config.Config{Model: chunkTestModel}}
+	budget := budgetFor(10)
+
+	// A hunk larger than the budget is split into parts.
+	body := c.splitDiff(testDiff(testHunk(40)), budget)
+	if len(body.chunks) < 2 || len(body.chunks) > maxChunksPerFile {
+		t.Fatalf("unexpected number of chunks %d", len(body.chunks))
+	}
+	lines := 0
+	for i, chunk := range body.chunks {
+		title := fmt.Sprintf("### File: main.go (part %d/%d)\n", i+1, len(body.chunks))
+		if !strings.HasPrefix(chunk, title) {
+			t.Errorf("chunk %d: expected the title %q in %q", i, title, chunk)
+		}
+		lines += strings.Count(chunk, "+x")
+	}
+	if lines != 40 || body.skipped != "" {
+		t.Errorf("expected all 40 lines to be sent, got %d, skipped %q", lines, body.skipped)
+	}
+
+	// Hunks which don't fit in maxChunksPerFile chunks are skipped.
+	var hunks [][]string
+	for i := 0; i < maxChunksPerFile+4; i++ {
+		hunks = append(hunks, testHunk(10))
+	}
+	body = c.splitDiff(testDiff(hunks...), budget)
+	if len(body.chunks) != maxChunksPerFile {
+		t.Errorf("expected %d chunks, got %d", maxChunksPerFile, len(body.chunks))
+	}
+	if want := "4 hunks (44 lines) beyond 8 chunks"; body.skipped != want {
+		t.Errorf("expected %q, got %q", want, body.skipped)
+	}
+
+	// Only the lines which are not sent are counted when the cap cuts a hunk.
+	hunks = hunks[:maxChunksPerFile-1]
+	big := testHunk(30)
+	hunks = append(hunks, big)
+	body = c.splitDiff(testDiff(hunks...), budget)
+	pieces := splitHunk(big, budget, lineCount)
+	if len(pieces) < 2 {
+		t.Fatalf("expected the last hunk to be split, got %d pieces", len(pieces))
+	}
+	sent := len(pieces[0])
+	if want := fmt.Sprintf("1 hunk (%d lines) beyond 8 chunks", len(big)-sent); body.skipped != want {
+		t.Errorf("expected %q, got %q", want, body.skipped)
+	}
+	if got := strings.Count(body.chunks[maxChunksPerFile-1], "+x"); got != sent-1 {
+		t.Errorf("expected %d lines of the last hunk to be sent, got %d", sent-1, got)
+	}
+}
+
+func TestSplitDiffWithoutHunks(t *testing.T) {
+	c := &cli{cfg: config.Config{Model: chunkTestModel}}
+
+	binary := git.FileDiff{Path: "logo.png", DiffContents: []string{
+		"index 1111111..2222222 100644",
+		"Binary files a/logo.png and b/logo.png differ",
+	}}
+	body := c.splitDiff(binary, budgetFor(10))
+	if !reflect.DeepEqual(body.chunks, []string{"### File: logo.png\n"}) || body.skipped != "binary content" {
+		t.Errorf("binary: unexpected body %+v", body)
+	}
+
+	renamed := git.FileDiff{Path: "old.go", DiffContents: []string{
+		"similarity index 100%",
+		"rename from old.go",
+		"rename to new.go",
+	}}
+	body = c.splitDiff(renamed, budgetFor(10))
+	if len(body.chunks) != 1 || !strings.Contains(body.chunks[0], "rename to new.go") || body.skipped != "" {
+		t.Errorf("rename: unexpected body %+v", body)
+	}
+}
+
+func TestPlural(t *testing.T) {
+	tests := map[int]string{0: "0 hunks", 1: "1 hunk", 2: "2 hunks"}
+	for n, want := range tests {
+		if got := plural(n, "hunk"); got != want {
+			t.Errorf("%d: expected %q, got %q", n, want, got)
+		}
+	}
+}
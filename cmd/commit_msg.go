@@ -0,0 +1,124 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tetran/lgh/internal/git"
+)
+
+var commitMsgCmd = &cobra.Command{
+	Use:   "commit-msg",
+	Short: "Draft a commit message from the staged changes",
+	Long: `Draft a commit message from the staged changes (git diff --cached).
+Each file is summarized as in branch-summary, and the message follows Conventional Commits,
+or the style set by commit-style in the config file.`,
+	Args: cobra.NoArgs,
+	Run:  commitMsg,
+}
+
+func init() {
+	commitMsgCmd.Flags().String("style", "", "Style of the message: conventional, or a description of the style (default: commit-style in the config file)")
+	commitMsgCmd.Flags().BoolP("edit", "e", false, "Run \"git commit -e\" with the draft filled in")
+	commitMsgCmd.Flags().StringP("output", "o", "", "Write the draft to this file instead of stdout")
+	commitMsgCmd.Flags().BoolP("debug", "d", false, "Enable debug mode")
+	commitMsgCmd.Flags().IntP("concurrency", "c", 1, "Number of requests sent to the LLM in parallel")
+	commitMsgCmd.Flags().Bool("no-cache", false, "Summarize every file again instead of reusing cached summaries")
+	commitMsgCmd.Flags().Duration("timeout", 0, "Time limit of the whole draft, e.g. 1m (0: no limit)")
+	commitMsgCmd.Flags().Duration("request-timeout", 0, "Time limit of each request to the LLM, e.g. 2m (default: depends on the provider)")
+}
+
+func commitMsg(cmd *cobra.Command, args []string) {
+	style, err := cmd.Flags().GetString("style")
+	cobra.CheckErr(err)
+	edit, err := cmd.Flags().GetBool("edit")
+	cobra.CheckErr(err)
+
+	cli, ctx, cancel := newCLI(cmd)
+	defer cancel()
+	if style == "" {
+		style = cli.cfg.CommitStyle
+	}
+	msg, err := cli.commitMessage(ctx, style)
+	cobra.CheckErr(err)
+
+	switch {
+	case edit:
+		err = gitCommit(cmd.Context(), cli.repo.Path, msg)
+	case cli.output != "":
+		err = os.WriteFile(cli.output, []byte(msg+"\n"), 0644)
+	default:
+		fmt.Println(msg)
+	}
+	cobra.CheckErr(err)
+}
+
+// commitMessage drafts the commit message of the staged changes. The files are summarized
+// as the files of a commit are, and their summaries are cached, so drafting again after staging
+// another file only summarizes that file.
+func (c *cli) commitMessage(ctx context.Context, style string) (string, error) {
+	if _, err := c.loadPrompts(ctx); err != nil {
+		return "", err
+	}
+	diffs, err := c.repo.StagedDiff(ctx)
+	if err != nil {
+		return "", err
+	}
+	diffs = c.included(diffs)
+	if len(diffs) == 0 {
+		return "", fmt.Errorf("no changes are staged; stage them with `git add` first")
+	}
+
+	commit := git.Commit{Diffs: diffs}
+	info, bodies, err := c.commitText(commit)
+	if err != nil {
+		return "", err
+	}
+	c.progress = newProgress(os.Stderr, 0, 1, c.totalTokens)
+	defer c.progress.finish()
+	c.progress.commitStarted(commit, len(bodies))
+	cd := commitData(commit, bodies)
+	fileSums, err := c.sumFiles(ctx, commit, cd, info, bodies)
+	if err != nil {
+		return "", err
+	}
+
+	messages, err := c.messageMessages(cd, style, strings.Join(fileSums, ""))
+	if err != nil {
+		return "", err
+	}
+	res, err := c.chat(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	c.progress.commitDone()
+	return unwrapCodeBlock(res.Content), nil
+}
+
+// gitCommit runs `git commit -e` with the message filled in, so that it is reviewed before committing.
+func gitCommit(ctx context.Context, dir, msg string) error {
+	f, err := os.CreateTemp("", "lgh-commit-msg-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(msg + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "commit", "-e", "-F", f.Name())
+	cmd.Dir = dir
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
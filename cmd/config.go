@@ -4,66 +4,610 @@ Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/tetran/lgh/internal/config"
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/locale"
+	"github.com/tetran/lgh/internal/secret"
 )
 
-var configCmd = &cobra.Command{
-	Use:   "config",
-	Short: "Configure the application",
-	Long:  `Configure the application by setting values required for the application to run.`,
-	Run:   configure,
-}
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the configuration",
+		Long: `Manage the configuration in ~/.lgh/config.yaml, or in the repository's .lgh.yaml with --repo.
+With --profile, the values of the named profile are changed instead of the top-level ones.
+
+Run "lgh config init" to configure the application for the first time.`,
+	}
+	configInitCmd = &cobra.Command{
+		Use:   "init",
+		Short: "Configure the application interactively or with flags",
+		Long: `Configure the application by setting values required for the application to run.
+Without flags, the settings are asked for interactively. Other keys in the config file are kept.`,
+		Args: cobra.NoArgs,
+		Run:  configInit,
+	}
+	configSetCmd = &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "Set a value in the config file",
+		Args:  cobra.ExactArgs(2),
+		Run:   configSet,
+	}
+	configGetCmd = &cobra.Command{
+		Use:   "get KEY",
+		Short: "Print the value in effect",
+		Long:  `Print the value in effect, from the environment (LGH_<KEY>, e.g. LGH_OPENAI_MODEL), the config files or the profile. API keys are masked.`,
+		Args:  cobra.ExactArgs(1),
+		Run:   configGet,
+	}
+	configUnsetCmd = &cobra.Command{
+		Use:   "unset KEY",
+		Short: "Remove a value from the config file",
+		Long: `Remove a value from the config file. Removing an API key also deletes it from the
+secret store it is kept in.`,
+		Args: cobra.ExactArgs(1),
+		Run:  configUnset,
+	}
+	configListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the values set in the config file",
+		Args:  cobra.NoArgs,
+		Run:   configList,
+	}
+	configEditCmd = &cobra.Command{
+		Use:   "edit",
+		Short: "Edit the config file with $EDITOR",
+		Long: `Edit the config file with $VISUAL or $EDITOR (default: vi).
+The file is replaced only if the edited values are valid.`,
+		Args: cobra.NoArgs,
+		Run:  configEdit,
+	}
+	configShowCmd = &cobra.Command{
+		Use:   "show",
+		Short: "Show the configuration in effect",
+		Long: `Show the configuration in effect: the user's config file, with the repository's
+.lgh.yaml merged over it. API keys are masked.`,
+		Run: configShow,
+	}
+)
 
 func init() {
-	configCmd.Flags().StringP("openai-api-key", "", "", "OpenAI API key")
-	configCmd.Flags().StringP("openai-model", "", "", "OpenAI model")
-	configCmd.Flags().StringP("lang", "", "", "Output language")
+	configInitCmd.Flags().StringP("provider", "", "", "LLM provider (openai/anthropic/ollama/azure)")
+	configInitCmd.Flags().StringP("openai-api-key", "", "", "OpenAI API key")
+	configInitCmd.Flags().StringP("openai-api-key-command", "", "", "Command printing the OpenAI API key, e.g. \"pass show openai\"")
+	configInitCmd.Flags().StringP("openai-model", "", "", "OpenAI model")
+	configInitCmd.Flags().StringP("openai-base-url", "", "", "Base URL of an OpenAI compatible API (default: https://api.openai.com/v1)")
+	configInitCmd.Flags().StringP("anthropic-api-key", "", "", "Anthropic API key")
+	configInitCmd.Flags().StringP("anthropic-api-key-command", "", "", "Command printing the Anthropic API key")
+	configInitCmd.Flags().StringP("anthropic-model", "", "", "Anthropic model")
+	configInitCmd.Flags().StringP("ollama-model", "", "", "Ollama model")
+	configInitCmd.Flags().StringP("ollama-base-url", "", "", "Base URL of the Ollama server (default: http://localhost:11434)")
+	configInitCmd.Flags().StringP("azure-api-key", "", "", "Azure OpenAI API key")
+	configInitCmd.Flags().StringP("azure-api-key-command", "", "", "Command printing the Azure OpenAI API key")
+	configInitCmd.Flags().StringP("azure-base-url", "", "", "Azure OpenAI resource endpoint (e.g. https://NAME.openai.azure.com)")
+	configInitCmd.Flags().StringP("azure-deployment", "", "", "Azure OpenAI deployment name")
+	configInitCmd.Flags().StringP("azure-api-version", "", "", "Azure OpenAI API version (default: 2024-06-01)")
+	configInitCmd.Flags().StringP("azure-model", "", "", "Model of the Azure OpenAI deployment (default: the deployment name)")
+	configInitCmd.Flags().StringP("lang", "", "", "Output language, a BCP-47 tag such as en, ja or pt-BR")
+	configInitCmd.Flags().Float64("temperature", 0, "Sampling temperature of the model (default: 0.7)")
+	configInitCmd.Flags().String("api-key-store", "", apiKeyStoreUsage)
+
+	configSetCmd.Flags().String("api-key-store", "", apiKeyStoreUsage)
+	for _, c := range []*cobra.Command{configSetCmd, configUnsetCmd, configListCmd, configEditCmd} {
+		c.Flags().Bool("repo", false, "Use "+config.RepoFile+" of the current repository")
+	}
+
+	var keys strings.Builder
+	for _, k := range config.Keys() {
+		fmt.Fprintf(&keys, "  %-26s %s\n", k.Name, k.Description)
+	}
+	configSetCmd.Long = `Set a value in the config file. Other keys are kept.
+An API key is kept in the store chosen by --api-key-store, or the one already configured.
+
+Keys:
+` + strings.TrimRight(keys.String(), "\n")
+
+	configShowCmd.Flags().Bool("origin", false, "Show where each value comes from")
+	configCmd.AddCommand(configInitCmd, configSetCmd, configGetCmd, configUnsetCmd, configListCmd, configEditCmd, configShowCmd)
 }
 
-func configure(cmd *cobra.Command, args []string) {
-	key, err := cmd.Flags().GetString("openai-api-key")
-	cobra.CheckErr(err)
+const apiKeyStoreUsage = "Where to keep the API key: keyring, file (encrypted with a passphrase) or config (default: keyring when available, otherwise file)"
+
+// providerSettings are the provider specific settings other than the model,
+// in the order the interactive configuration asks for them.
+var providerSettings = []struct {
+	name   string
+	prompt string
+}{
+	{"api-key", "API key (leave empty for a self-hosted server or a key command)"},
+	{"api-key-command", "Command printing the API key, e.g. `pass show openai` (leave empty if you entered the key)"},
+	{"base-url", "Base URL / endpoint (leave empty for the default)"},
+	{"deployment", "Deployment name"},
+	{"api-version", "API version (leave empty for the default)"},
+}
 
-	model, err := cmd.Flags().GetString("openai-model")
+func configInit(cmd *cobra.Command, args []string) {
+	provider, err := cmd.Flags().GetString("provider")
 	cobra.CheckErr(err)
+	if provider == "" {
+		provider = config.ProviderOpenAI
+	}
+	parseValue("provider", provider)
+
+	values := map[string]string{}
+	for _, ps := range providerSettings {
+		values[ps.name] = providerFlag(cmd, provider, ps.name)
+	}
+	model := providerFlag(cmd, provider, "model")
 
 	lng, err := cmd.Flags().GetString("lang")
 	cobra.CheckErr(err)
 
-	if key == "" && lng == "" && model == "" {
-		fmt.Println("Please enter the OpenAI API key and the output language.")
-		fmt.Print("OpenAI API key: ")
-		fmt.Scanln(&key)
-		fmt.Print("Please enter the OpenAI model (default: gpt-3.5-turbo): ")
-		fmt.Scanln(&model)
+	empty := lng == "" && model == "" && !cmd.Flags().Changed("temperature")
+	for _, v := range values {
+		empty = empty && v == ""
+	}
+	if empty {
+		// Whole lines are read: a key command has spaces in it.
+		in := bufio.NewReader(cmd.InOrStdin())
+		readLine := func() string {
+			line, _ := in.ReadString('\n')
+			return strings.TrimSpace(line)
+		}
+		fmt.Printf("Please enter the %s settings and the output language.\n", provider)
+		for _, ps := range providerSettings {
+			if cmd.Flags().Lookup(provider+"-"+ps.name) == nil {
+				continue
+			}
+			fmt.Printf("%s: ", ps.prompt)
+			values[ps.name] = readLine()
+		}
+		def := config.DefaultModels[provider]
+		if def == "" {
+			def = "the deployment name"
+		}
+		fmt.Printf("Please enter the model (default: %s): ", def)
+		model = readLine()
 		if model == "" {
-			model = "gpt-3.5-turbo"
+			model = config.DefaultModels[provider]
 		}
-		fmt.Print("Output language (available: [en/ja], default: en): ")
-		fmt.Scanln(&lng)
+		fmt.Printf("Output language (available: [%s], default: %s): ", strings.Join(locale.Tags(), "/"), locale.Default)
+		lng = readLine()
 		if lng == "" {
-			lng = "en"
+			lng = locale.Default
+		}
+	}
+
+	f := openConfigFile(cmd)
+	// Only the values given are written; other keys in the file are kept.
+	if empty || cmd.Flags().Changed("provider") {
+		f.v.Set(f.prefix+"provider", provider)
+	}
+	if lng != "" {
+		f.v.Set(f.prefix+"lang", parseValue("lang", lng))
+	}
+	if model != "" {
+		f.v.Set(f.prefix+provider+"-model", model)
+	}
+	if cmd.Flags().Changed("temperature") {
+		temperature := cmd.Flags().Lookup("temperature").Value.String()
+		f.v.Set(f.prefix+"temperature", parseValue("temperature", temperature))
+	}
+	for _, ps := range providerSettings {
+		if val := values[ps.name]; val != "" && ps.name != "api-key" {
+			key := provider + "-" + ps.name
+			f.v.Set(f.prefix+key, parseValue(key, val))
+		}
+	}
+	if key := values["api-key"]; key != "" {
+		f.v = saveAPIKey(cmd, f.v, f.prefix, provider, key)
+	}
+	f.save()
+	if profile != "" {
+		fmt.Printf("Saved profile %s in %s\n", profile, f.path)
+	}
+}
+
+// parseValue checks the value of a known key and converts it to the type stored in the config file.
+func parseValue(name, value string) any {
+	key, err := config.LookupKey(name)
+	cobra.CheckErr(err)
+	v, err := key.Parse(value)
+	cobra.CheckErr(err)
+	return v
+}
+
+func configSet(cmd *cobra.Command, args []string) {
+	name := strings.ToLower(args[0])
+	value := parseValue(name, args[1])
+
+	f := openConfigFile(cmd)
+	if f.repo {
+		cobra.CheckErr(config.CheckRepoKey(name))
+	}
+	if provider, ok := strings.CutSuffix(name, "-api-key"); ok {
+		f.v = saveAPIKey(cmd, f.v, f.prefix, provider, args[1])
+	} else {
+		f.v.Set(f.prefix+name, value)
+	}
+	f.save()
+}
+
+func configGet(cmd *cobra.Command, args []string) {
+	name := strings.ToLower(args[0])
+	_, err := config.LookupKey(name)
+	cobra.CheckErr(err)
+
+	if !viper.IsSet(name) {
+		fmt.Fprintf(os.Stderr, "%s is not set\n", name)
+		os.Exit(1)
+	}
+	fmt.Println(formatValue(name, viper.Get(name)))
+}
+
+func configUnset(cmd *cobra.Command, args []string) {
+	name := strings.ToLower(args[0])
+	_, err := config.LookupKey(name)
+	cobra.CheckErr(err)
+
+	f := openConfigFile(cmd)
+	provider, isAPIKey := strings.CutSuffix(name, "-api-key")
+	storeKey := f.prefix + provider + "-api-key-store"
+	// An API key kept in a secret store leaves only its store in the file.
+	if !f.v.IsSet(f.prefix+name) && !(isAPIKey && f.v.IsSet(storeKey)) {
+		fmt.Fprintf(os.Stderr, "%s is not set in %s\n", name, f.path)
+		os.Exit(1)
+	}
+	if isAPIKey {
+		deleteAPIKey(f.v.GetString(storeKey), provider)
+		f.v = withoutKey(f.v, storeKey)
+	}
+	f.v = withoutKey(f.v, f.prefix+name)
+	f.save()
+}
+
+// deleteAPIKey deletes the API key from the secret store it is kept in, if any.
+func deleteAPIKey(storeName, provider string) {
+	if storeName == "" || storeName == config.StoreConfig {
+		return
+	}
+	store, err := secretStore(storeName)
+	cobra.CheckErr(err)
+	err = store.Delete(config.SecretName(provider, profile))
+	if err != nil && !errors.Is(err, secret.ErrNotFound) {
+		cobra.CheckErr(err)
+	}
+}
+
+func configList(cmd *cobra.Command, args []string) {
+	f := openConfigFile(cmd)
+	for _, key := range f.keys() {
+		fmt.Printf("%s: %s\n", key, formatValue(key, f.v.Get(f.prefix+key)))
+	}
+}
+
+func configEdit(cmd *cobra.Command, args []string) {
+	f := openConfigFile(cmd)
+
+	// The changes are made to a copy, which replaces the file once it is valid.
+	src, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		cobra.CheckErr(err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".config-*.yaml")
+	cobra.CheckErr(err)
+	_, err = tmp.Write(src)
+	cobra.CheckErr(err)
+	cobra.CheckErr(tmp.Close())
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// The editor may be given with arguments, e.g. "code --wait".
+	c := exec.Command("sh", "-c", editor+` "$1"`, "--", tmp.Name())
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		os.Remove(tmp.Name())
+		cobra.CheckErr(fmt.Errorf("editor: %w", err))
+	}
+
+	edited := viper.New()
+	edited.SetConfigFile(tmp.Name())
+	edited.SetConfigType("yaml")
+	err = edited.ReadInConfig()
+	if err == nil {
+		err = errors.Join(checkConfig(edited, f.repo)...)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, "The file was not changed. Your edits are kept in %s\n", tmp.Name())
+		os.Exit(1)
+	}
+	cobra.CheckErr(os.Chmod(tmp.Name(), f.perm()))
+	cobra.CheckErr(os.Rename(tmp.Name(), f.path))
+}
+
+// checkConfig returns the errors of the keys and values of a config file.
+func checkConfig(v *viper.Viper, repo bool) []error {
+	var errs []error
+	for _, key := range v.AllKeys() {
+		name := key
+		if rest, ok := strings.CutPrefix(key, config.ProfileKey("")); ok && !repo {
+			if _, name, ok = strings.Cut(rest, "."); !ok {
+				errs = append(errs, fmt.Errorf("%s: a profile holds keys", key))
+				continue
+			}
+		}
+		if repo {
+			if err := config.CheckRepoKey(name); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		k, err := config.LookupKey(name)
+		if err == nil {
+			_, err = k.Parse(configString(v.Get(key)))
+		}
+		if err != nil && key != name {
+			err = fmt.Errorf("%s: %w", key, err)
+		}
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
+	return errs
+}
 
-	file := filepath.Join(os.Getenv("HOME"), config.WorkDir, "config.yaml")
-	err = os.MkdirAll(filepath.Dir(file), 0700)
+// configString returns a value read from a config file as it is given to `lgh config set`.
+func configString(v any) string {
+	if items, ok := v.([]any); ok {
+		s := make([]string, len(items))
+		for i, item := range items {
+			s[i] = fmt.Sprint(item)
+		}
+		return strings.Join(s, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// configFile is the file changed by the config subcommands: the user's config file, or the
+// repository's with --repo. The keys of the selected profile are under prefix.
+type configFile struct {
+	path   string
+	prefix string
+	repo   bool
+	v      *viper.Viper
+}
+
+func openConfigFile(cmd *cobra.Command) *configFile {
+	f := &configFile{}
+	if flag := cmd.Flags().Lookup("repo"); flag != nil && flag.Value.String() == "true" {
+		if profile != "" {
+			cobra.CheckErr(fmt.Errorf("profiles can't be used with --repo"))
+		}
+		current, err := os.Getwd()
+		cobra.CheckErr(err)
+		top, err := (&git.Repository{Path: current}).TopLevel(cmd.Context())
+		if err != nil {
+			cobra.CheckErr(fmt.Errorf("not a git repository"))
+		}
+		f.path = filepath.Join(top, config.RepoFile)
+		f.repo = true
+	} else {
+		f.path = cfgFile
+		if f.path == "" {
+			home, err := os.UserHomeDir()
+			cobra.CheckErr(err)
+			f.path = filepath.Join(home, config.WorkDir, "config.yaml")
+		}
+		if profile != "" {
+			f.prefix = config.ProfileKey(profile) + "."
+		}
+	}
+	err := os.MkdirAll(filepath.Dir(f.path), 0700)
 	cobra.CheckErr(err)
 
-	if _, err := os.Stat(file); err == nil {
-		err = os.Remove(file)
+	f.v = viper.New()
+	f.v.SetConfigFile(f.path)
+	f.v.SetConfigType("yaml")
+	f.v.SetConfigPermissions(f.perm())
+	if _, err := os.Stat(f.path); err == nil {
+		err = f.v.ReadInConfig()
 		cobra.CheckErr(err)
 	}
+	return f
+}
+
+// perm is the permissions of the file. The user's config file may hold API keys.
+func (f *configFile) perm() os.FileMode {
+	if f.repo {
+		return 0644
+	}
+	return 0600
+}
+
+// keys returns the keys set in the file for the selected profile, or the top-level ones, sorted.
+func (f *configFile) keys() []string {
+	var keys []string
+	for _, key := range f.v.AllKeys() {
+		if f.prefix != "" {
+			if key, ok := strings.CutPrefix(key, f.prefix); ok {
+				keys = append(keys, key)
+			}
+		} else if !strings.HasPrefix(key, config.ProfileKey("")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *configFile) save() {
+	f.v.SetConfigPermissions(f.perm())
+	err := f.v.WriteConfigAs(f.path)
+	cobra.CheckErr(err)
+}
+
+// saveAPIKey keeps the API key in the store chosen by --api-key-store, and records the store in the config.
+// Unless the store is the config file, the key is removed from it.
+func saveAPIKey(cmd *cobra.Command, v *viper.Viper, prefix, provider, key string) *viper.Viper {
+	storeName, err := cmd.Flags().GetString("api-key-store")
+	cobra.CheckErr(err)
+	if storeName == "" {
+		storeName = v.GetString(prefix + provider + "-api-key-store")
+	}
+	if storeName == "" {
+		storeName = config.StoreFile
+		if secret.KeyringAvailable() {
+			storeName = config.StoreKeyring
+		}
+	}
+	if storeName == config.StoreConfig {
+		v.Set(prefix+provider+"-api-key", key)
+		v.Set(prefix+provider+"-api-key-store", config.StoreConfig)
+		return v
+	}
 
-	f, err := os.Create(file)
+	store, err := secretStore(storeName)
 	cobra.CheckErr(err)
-	defer f.Close()
+	name := config.SecretName(provider, profile)
+	err = store.Set(name, key)
+	cobra.CheckErr(err)
+	fmt.Printf("Saved the API key as %s in the %s store\n", name, storeName)
+
+	v.Set(prefix+provider+"-api-key-store", storeName)
+	return withoutKey(v, prefix+provider+"-api-key")
+}
 
-	_, err = f.WriteString(fmt.Sprintf("openai-api-key: %s\nlang: %s\nopenai-model: %s\n", key, lng, model))
+// withoutKey returns a copy of the settings without the key, which viper can't unset.
+func withoutKey(v *viper.Viper, key string) *viper.Viper {
+	settings := v.AllSettings()
+	parts := strings.Split(key, ".")
+	m := settings
+	for _, p := range parts[:len(parts)-1] {
+		child, ok := m[p].(map[string]any)
+		if !ok {
+			return v
+		}
+		m = child
+	}
+	delete(m, parts[len(parts)-1])
+
+	nv := viper.New()
+	nv.SetConfigFile(v.ConfigFileUsed())
+	nv.SetConfigType("yaml")
+	nv.SetConfigPermissions(0600)
+	cobra.CheckErr(nv.MergeConfigMap(settings))
+	return nv
+}
+
+// providerFlag returns the value of the `<provider>-<name>` flag, or an empty string
+// if the provider has no such setting.
+func providerFlag(cmd *cobra.Command, provider, name string) string {
+	f := cmd.Flags().Lookup(provider + "-" + name)
+	if f == nil {
+		return ""
+	}
+	return f.Value.String()
+}
+
+func configShow(cmd *cobra.Command, args []string) {
+	showOrigin, err := cmd.Flags().GetBool("origin")
 	cobra.CheckErr(err)
+
+	values := map[string]string{}
+	origins := map[string]string{}
+	for _, key := range viper.AllKeys() {
+		// The selected profile is already merged; the others are not in effect.
+		if strings.HasPrefix(key, config.ProfileKey("")) {
+			continue
+		}
+		values[key] = formatValue(key, viper.Get(key))
+		origins[key] = configOrigin(key)
+	}
+	// The values used when nothing is set
+	cfg := loadConfig()
+	defaults := map[string]string{
+		"provider":              cfg.Provider,
+		cfg.Provider + "-model": cfg.Model,
+		"lang":                  locale.Default,
+		"base":                  "main",
+		"commit-style":          cfg.CommitStyle,
+	}
+	for key, v := range defaults {
+		if _, ok := values[key]; !ok && v != "" {
+			values[key] = v
+			origins[key] = "default"
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if showOrigin {
+			fmt.Printf("%s: %s  # %s\n", key, values[key], origins[key])
+		} else {
+			fmt.Printf("%s: %s\n", key, values[key])
+		}
+	}
+}
+
+// configOrigin tells which layer the value of the key comes from.
+func configOrigin(key string) string {
+	if _, ok := os.LookupEnv(config.EnvVar(key)); ok {
+		return "env"
+	}
+	if repoConfig.IsSet(key) {
+		return repoConfig.ConfigFileUsed()
+	}
+	if profileConfig.IsSet(key) {
+		return fmt.Sprintf("profile %s in %s", profile, viper.ConfigFileUsed())
+	}
+	if viper.InConfig(key) {
+		return viper.ConfigFileUsed()
+	}
+	return "default"
+}
+
+func formatValue(key string, v any) string {
+	switch v := v.(type) {
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case string:
+		if config.IsSecret(key) && v != "" {
+			return maskSecret(v)
+		}
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// maskSecret hides all but the last four characters of a secret.
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tetran/lgh/internal/config"
+	"github.com/tetran/lgh/internal/secret"
+)
+
+// fakeSecretTool puts a secret-tool keeping the secrets in files of a temporary directory first on $PATH.
+func fakeSecretTool(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("the keyring is used through secret-tool on Linux only")
+	}
+	bin, store := t.TempDir(), t.TempDir()
+	script := `#!/bin/sh
+cmd=$1
+for last; do :; done
+case $cmd in
+store) cat > "` + store + `/$last" ;;
+lookup) cat "` + store + `/$last" 2>/dev/null ;;
+clear) rm -f "` + store + `/$last" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "secret-tool"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// configTestCmd returns a command with the flags of config set and unset.
+func configTestCmd(store string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("api-key-store", store, "")
+	cmd.Flags().Bool("repo", false, "")
+	return cmd
+}
+
+func TestConfigUnsetAPIKey(t *testing.T) {
+	for _, store := range []string{config.StoreKeyring, config.StoreFile} {
+		t.Run(store, func(t *testing.T) {
+			if store == config.StoreKeyring {
+				fakeSecretTool(t)
+			}
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv(config.PassphraseEnv, "passphrase")
+			cfgFile = filepath.Join(t.TempDir(), "config.yaml")
+			t.Cleanup(func() { cfgFile = "" })
+
+			configSet(configTestCmd(store), []string{"openai-api-key", "sk-x"})
+			s, err := secretStore(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key, err := s.Get("openai-api-key"); err != nil || key != "sk-x" {
+				t.Fatalf("expected the key in the %s store, got %q, %v", store, key, err)
+			}
+
+			configUnset(configTestCmd(""), []string{"openai-api-key"})
+			if _, err := s.Get("openai-api-key"); !errors.Is(err, secret.ErrNotFound) {
+				t.Errorf("expected the key to be deleted from the %s store, got %v", store, err)
+			}
+			v := viper.New()
+			v.SetConfigFile(cfgFile)
+			if err := v.ReadInConfig(); err != nil {
+				t.Fatal(err)
+			}
+			if keys := v.AllKeys(); len(keys) != 0 {
+				t.Errorf("expected an empty config file, got %v", keys)
+			}
+		})
+	}
+}
+
+func TestConfigInitInteractive(t *testing.T) {
+	cfgFile = filepath.Join(t.TempDir(), "config.yaml")
+	t.Cleanup(func() {
+		cfgFile = ""
+		configInitCmd.SetIn(nil)
+	})
+
+	// No API key, a key command, the default base URL and model, and Japanese
+	configInitCmd.SetIn(strings.NewReader("\n  pass show openai/api \n\n\nja\n"))
+	configInit(configInitCmd, nil)
+
+	v := viper.New()
+	v.SetConfigFile(cfgFile)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"provider":               config.ProviderOpenAI,
+		"openai-api-key-command": "pass show openai/api",
+		"openai-model":           config.DefaultModels[config.ProviderOpenAI],
+		"lang":                   "ja",
+	}
+	for key, value := range want {
+		if got := v.GetString(key); got != value {
+			t.Errorf("%s: expected %q, got %q", key, value, got)
+		}
+	}
+	if v.IsSet("openai-api-key") || v.IsSet("openai-base-url") {
+		t.Errorf("expected the empty answers to be left unset, got %v", v.AllSettings())
+	}
+}
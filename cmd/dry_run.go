@@ -0,0 +1,182 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tetran/lgh/internal/llm"
+	"github.com/tetran/lgh/internal/tokens"
+)
+
+// Expected completion sizes, in tokens, used to estimate the cost of a run.
+// The prompts ask for brief bullet points, so the answers are short.
+const (
+	estFileCompletion   = 120
+	estCommitCompletion = 100
+	estReduceCompletion = 500
+	estRollupPerCommit  = 60
+	estRollupMinimum    = 200
+	estRollupMaximum    = 2000
+)
+
+type estimate struct {
+	estimator  *tokens.Estimator
+	files      int
+	commits    int
+	reduces    int
+	rollups    int
+	cached     int
+	prompt     int
+	completion int
+}
+
+func (e *estimate) add(messages []*llm.Message, extraPrompt, completion int) {
+	e.prompt += promptTokens(e.estimator, messages) + extraPrompt
+	e.completion += completion
+}
+
+// estimate builds every prompt exactly as summarize would and counts the requests
+// and the estimated tokens, without sending anything.
+// Answers are not known in advance, so prompts that contain earlier answers are
+// estimated with the expected size of those answers.
+func (c *cli) estimate(ctx context.Context) (*estimate, error) {
+	commits, err := c.commits(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "[Commits] %d\n", len(commits))
+
+	est := &estimate{estimator: tokens.ForModel(c.cfg.Model)}
+	summarized := 0
+	for _, commit := range commits {
+		if commit.IsMerge {
+			continue
+		}
+		summarized++
+
+		info, bodies, err := c.commitText(commit)
+		if err != nil {
+			return nil, err
+		}
+
+		cd := commitData(commit, bodies)
+		fileCompletions := 0
+		for i, body := range bodies {
+			diff := commit.Diffs[i]
+			if !c.noCache && c.cache.Has(c.fileKey(commit, diff)) {
+				est.cached++
+				continue
+			}
+			for _, chunk := range body.chunks {
+				messages, err := c.fileMessages(cd, body.file, info, chunk)
+				if err != nil {
+					return nil, err
+				}
+				est.files++
+				est.add(messages, 0, estFileCompletion)
+			}
+			if n := len(body.chunks); n > 1 {
+				messages, err := c.mergeMessages(cd, body.file, "")
+				if err != nil {
+					return nil, err
+				}
+				est.files++
+				est.add(messages, n*estFileCompletion, estFileCompletion)
+			}
+			fileCompletions += estFileCompletion
+		}
+
+		if !c.noCache && c.cache.Has(c.commitKey(commit)) {
+			est.cached++
+			continue
+		}
+		messages, err := c.commitMessages(cd, fmt.Sprintf("%s\n## Change details:\n", info))
+		if err != nil {
+			return nil, err
+		}
+		est.commits++
+		est.add(messages, fileCompletions, estCommitCompletion)
+	}
+
+	// Simulate reduce with the expected sizes of the summaries.
+	sizes := make([]int, summarized)
+	for i := range sizes {
+		sizes[i] = estCommitCompletion
+	}
+	budget, err := c.rollupBudget()
+	if err != nil {
+		return nil, err
+	}
+	reduceMessages, err := c.reduceMessages("")
+	if err != nil {
+		return nil, err
+	}
+	for level := 1; level <= maxReduceLevels && sum(sizes) > budget; level++ {
+		batches := batchBySize(sizes, budget)
+		for _, b := range batches {
+			est.reduces++
+			est.add(reduceMessages, sum(sizes[b[0]:b[1]]), estReduceCompletion)
+		}
+		sizes = make([]int, len(batches))
+		for i := range sizes {
+			sizes[i] = estReduceCompletion
+		}
+	}
+
+	// Only the roll-up is made once per output language.
+	rollup := min(max(estRollupMinimum, estRollupPerCommit*summarized), estRollupMaximum)
+	for _, lang := range c.langs {
+		rollupMessages, err := c.rollupMessages(lang, "")
+		if err != nil {
+			return nil, err
+		}
+		est.rollups++
+		est.add(rollupMessages, sum(sizes), rollup)
+	}
+
+	return est, nil
+}
+
+// printEstimate reports the requests, the tokens and the cost of the estimated run.
+func (c *cli) printEstimate(est *estimate) {
+	fmt.Fprintln(os.Stderr, "[Dry run] No requests were sent.")
+	fmt.Fprintf(os.Stderr,
+		"[Requests] %d (files and chunks: %d, commits: %d, reduce: %d, roll-up: %d, cached: %d)\n",
+		est.files+est.commits+est.reduces+est.rollups, est.files, est.commits, est.reduces, est.rollups, est.cached)
+	fmt.Fprintf(os.Stderr,
+		"[Estimated tokens] %d (prompt: %d, completion: %d; %s, expect an error of about 20%%)\n",
+		est.prompt+est.completion, est.prompt, est.completion, est.estimator.Name)
+
+	model := tokens.Lookup(c.cfg.Model)
+	if !model.PriceKnown() {
+		fmt.Fprintf(os.Stderr, "[Estimated cost] unknown (no price for model `%s`)\n", c.cfg.Model)
+		return
+	}
+	fmt.Fprintf(os.Stderr,
+		"[Estimated cost] $%.4f (%s: $%.2f / $%.2f per 1M prompt / completion tokens)\n",
+		model.Cost(est.prompt, est.completion),
+		c.cfg.Model, model.InputPrice, model.OutputPrice)
+}
+
+// promptTokens estimates the prompt tokens of the messages with the estimator of the model,
+// as the rate limiter and the chunks count them.
+func promptTokens(tok *tokens.Estimator, messages []*llm.Message) int {
+	n := 0
+	for _, m := range messages {
+		// Every message carries a few tokens of framing.
+		n += tok.Count(m.Content) + 4
+	}
+	return n
+}
+
+func sum(values []int) int {
+	n := 0
+	for _, v := range values {
+		n += v
+	}
+	return n
+}
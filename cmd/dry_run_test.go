@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tetran/lgh/internal/cache"
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/tokens"
+)
+
+func TestEstimate(t *testing.T) {
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "-q", "-b", "main")
+	gitRun(t, dir, "config", "user.email", "test@example.com")
+	gitRun(t, dir, "config", "user.name", "Test")
+	commitFile(t, dir, "a.txt", "a\n", "-m", "Initial commit")
+	gitRun(t, dir, "checkout", "-q", "-b", "feature")
+	commitFile(t, dir, "b.txt", "b\n", "-m", "Add b")
+	commitFile(t, dir, "c.txt", "c\nc\n", "-m", "Add c")
+
+	c := newReduceTestCLI(t, nil)
+	c.repo = &git.Repository{Path: dir}
+	c.base, c.tgt = "main", "feature"
+	c.cache = &cache.Cache{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	full, err := c.estimate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One file and one commit request per commit, and the roll-up
+	if full.files != 2 || full.commits != 2 || full.reduces != 0 || full.rollups != 1 || full.cached != 0 {
+		t.Errorf("unexpected requests %+v", full)
+	}
+	if want := 2*estFileCompletion + 2*estCommitCompletion + estRollupMinimum; full.completion != want {
+		t.Errorf("expected %d completion tokens, got %d", want, full.completion)
+	}
+
+	// The summaries of the first commit are cached.
+	commits, err := c.commits(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commits[len(commits)-1]
+	info, bodies, err := c.commitText(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := commitData(first, bodies)
+	fileMessages, err := c.fileMessages(cd, bodies[0].file, info, bodies[0].chunks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitMessages, err := c.commitMessages(cd, fmt.Sprintf("%s\n## Change details:\n", info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{c.fileKey(first, first.Diffs[0]), c.commitKey(first)}
+	past := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	for _, key := range keys {
+		if err := c.cache.Put(key, "* cached"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(c.cache.Dir, key[:2], key), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hit, err := c.estimate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hit.files != 1 || hit.commits != 1 || hit.rollups != 1 || hit.cached != 2 {
+		t.Errorf("unexpected requests %+v", hit)
+	}
+	if want := full.completion - estFileCompletion - estCommitCompletion; hit.completion != want {
+		t.Errorf("expected %d completion tokens, got %d", want, hit.completion)
+	}
+	// The cached requests are left out, with the file summary the commit request would include.
+	tok := tokens.ForModel(c.cfg.Model)
+	saved := promptTokens(tok, fileMessages) + promptTokens(tok, commitMessages) + estFileCompletion
+	if hit.prompt != full.prompt-saved {
+		t.Errorf("expected %d prompt tokens, got %d", full.prompt-saved, hit.prompt)
+	}
+	// A dry run doesn't refresh the entries it finds.
+	for _, key := range keys {
+		info, err := os.Stat(filepath.Join(c.cache.Dir, key[:2], key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(past) {
+			t.Errorf("expected the cache entry to be left untouched, got %v", info.ModTime())
+		}
+	}
+
+	c.noCache = true
+	again, err := c.estimate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *again != *full {
+		t.Errorf("expected the cache to be ignored with --no-cache, got %+v", again)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/hook"
+)
+
+var (
+	hookCmd = &cobra.Command{
+		Use:   "hook",
+		Short: "Manage the git hook pre-filling commit messages",
+	}
+	hookInstallCmd = &cobra.Command{
+		Use:   "install",
+		Short: "Install the prepare-commit-msg hook in the current repository",
+		Long: `Install the prepare-commit-msg hook in the current repository. The hook pre-fills the
+message of "git commit" with a draft of "lgh commit-msg", unless the message is given with -m or -F,
+or comes from a template, a merge, a squash or an amended commit.
+
+A prepare-commit-msg hook already in place is kept and run first. When the model can't be
+reached in time, the hook gives up quietly and the commit goes on.`,
+		Args: cobra.NoArgs,
+		Run:  hookInstall,
+	}
+	hookUninstallCmd = &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove the prepare-commit-msg hook from the current repository",
+		Long:  `Remove the prepare-commit-msg hook, and put back the hook which was in place before, if any.`,
+		Args:  cobra.NoArgs,
+		Run:   hookUninstall,
+	}
+)
+
+// defaultHookTimeout bounds the wait in front of "git commit".
+const defaultHookTimeout = 60 * time.Second
+
+func init() {
+	hookInstallCmd.Flags().Duration("timeout", defaultHookTimeout, "Time limit of the draft, after which the message is left empty")
+	hookCmd.AddCommand(hookInstallCmd, hookUninstallCmd)
+}
+
+func hookInstall(cmd *cobra.Command, args []string) {
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	cobra.CheckErr(err)
+	dir := hooksDir(cmd.Context())
+
+	// The hook runs this executable, so that it works without lgh in the PATH of git.
+	exe, err := os.Executable()
+	cobra.CheckErr(err)
+	exe, err = filepath.EvalSymlinks(exe)
+	cobra.CheckErr(err)
+
+	chained, err := hook.Install(dir, hook.Script(exe, timeout))
+	cobra.CheckErr(err)
+	path := filepath.Join(dir, hook.Name)
+	if chained {
+		fmt.Printf("Installed %s; the existing hook runs first\n", path)
+	} else {
+		fmt.Printf("Installed %s\n", path)
+	}
+}
+
+func hookUninstall(cmd *cobra.Command, args []string) {
+	dir := hooksDir(cmd.Context())
+	restored, err := hook.Uninstall(dir)
+	if errors.Is(err, hook.ErrNotInstalled) {
+		fmt.Fprintln(os.Stderr, "The hook is not installed")
+		os.Exit(1)
+	}
+	cobra.CheckErr(err)
+	path := filepath.Join(dir, hook.Name)
+	if restored {
+		fmt.Printf("Removed %s and restored the hook it ran\n", path)
+	} else {
+		fmt.Printf("Removed %s\n", path)
+	}
+}
+
+// hooksDir returns the hooks directory of the current repository.
+func hooksDir(ctx context.Context) string {
+	current, err := os.Getwd()
+	cobra.CheckErr(err)
+	repo := &git.Repository{Path: current}
+	if !repo.IsGitRepository(ctx) {
+		cobra.CheckErr(fmt.Errorf("not a git repository"))
+	}
+	dir, err := repo.GitPath(ctx, "hooks")
+	cobra.CheckErr(err)
+	return dir
+}
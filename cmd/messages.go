@@ -0,0 +1,153 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/llm"
+	"github.com/tetran/lgh/internal/locale"
+	"github.com/tetran/lgh/internal/prompt"
+)
+
+// The prompts are text/template files; see the prompt package for the built-in ones
+// and `lgh prompts export` to customize them.
+
+// part is one prompt of a request and the data it is rendered with.
+type part struct {
+	name string
+	data *prompt.Data
+}
+
+// render builds a request from the persona and the given prompts.
+// The last prompt is the instruction sent as the user message; the others are system messages.
+func (c *cli) render(parts ...part) ([]*llm.Message, error) {
+	// The persona is in the language of the instruction.
+	persona := c.promptData("")
+	persona.Lang, persona.LangHint = parts[len(parts)-1].data.Lang, parts[len(parts)-1].data.LangHint
+	parts = append([]part{{prompt.System, persona}}, parts...)
+	messages := make([]*llm.Message, 0, len(parts))
+	for i, p := range parts {
+		content, err := c.prompts.Render(p.name, p.data)
+		if err != nil {
+			return nil, err
+		}
+		role := llm.RoleSystem
+		if i == len(parts)-1 {
+			role = llm.RoleUser
+		}
+		messages = append(messages, &llm.Message{Role: role, Content: content})
+	}
+	return messages, nil
+}
+
+// promptData returns the data common to every prompt, with the content to summarize.
+func (c *cli) promptData(content string) *prompt.Data {
+	return &prompt.Data{
+		Lang:     c.cfg.FullLang(),
+		LangHint: c.cfg.LangHint(),
+		Base:     c.base,
+		Target:   c.tgt,
+		Content:  content,
+	}
+}
+
+// langData is promptData in an output language. The other prompts are in the pivot language of the config.
+func (c *cli) langData(lang *locale.Locale, content string) *prompt.Data {
+	data := c.promptData(content)
+	data.Lang, data.LangHint = lang.Name, lang.Hint
+	return data
+}
+
+// commitData describes the commit to the templates. The files are those of the bodies,
+// so the summaries set on them later are seen by the commit prompt.
+func commitData(commit git.Commit, bodies []fileBody) *prompt.CommitData {
+	cd := &prompt.CommitData{
+		Hash:    commit.Hash,
+		Author:  commit.Author,
+		Date:    commit.Date,
+		Subject: commit.Subject(),
+		Message: strings.TrimSpace(commit.Message),
+		Files:   make([]*prompt.FileData, 0, len(bodies)),
+	}
+	for _, b := range bodies {
+		cd.Files = append(cd.Files, b.file)
+	}
+	return cd
+}
+
+// fileMessages builds the request summarizing one file change of a commit, or one chunk of it.
+func (c *cli) fileMessages(cd *prompt.CommitData, file *prompt.FileData, info, chunk string) ([]*llm.Message, error) {
+	overview := c.promptData(info)
+	overview.Commit = cd
+	data := c.promptData(chunk)
+	data.Commit = cd
+	data.File = file
+	return c.render(part{prompt.Overview, overview}, part{prompt.File, data})
+}
+
+// mergeMessages builds the request merging the summaries of the chunks of one file change.
+func (c *cli) mergeMessages(cd *prompt.CommitData, file *prompt.FileData, parts string) ([]*llm.Message, error) {
+	data := c.promptData(parts)
+	data.Commit = cd
+	data.File = file
+	return c.render(part{prompt.Merge, data})
+}
+
+// commitMessages builds the request summarizing a commit from its file summaries.
+func (c *cli) commitMessages(cd *prompt.CommitData, logs string) ([]*llm.Message, error) {
+	data := c.promptData(logs)
+	data.Commit = cd
+	return c.render(part{prompt.Commit, data})
+}
+
+// messageMessages builds the request drafting the commit message of staged changes from their file summaries.
+func (c *cli) messageMessages(cd *prompt.CommitData, style, summaries string) ([]*llm.Message, error) {
+	data := c.promptData(summaries)
+	data.Commit = cd
+	data.Style = style
+	return c.render(part{prompt.Message, data})
+}
+
+// reduceMessages builds the request combining a batch of commit summaries, when there are too many for the roll-up.
+func (c *cli) reduceMessages(summaries string) ([]*llm.Message, error) {
+	return c.render(part{prompt.Reduce, c.promptData(summaries)})
+}
+
+// branchMessages builds the request summarizing the whole branch from the commit summaries, in the language.
+func (c *cli) branchMessages(lang *locale.Locale, summaries string) ([]*llm.Message, error) {
+	return c.render(part{prompt.Branch, c.langData(lang, summaries)})
+}
+
+// sectionsMessages builds the request summarizing the whole branch as JSON sections, for --format json.
+func (c *cli) sectionsMessages(lang *locale.Locale, summaries string) ([]*llm.Message, error) {
+	return c.render(part{prompt.Sections, c.langData(lang, summaries)})
+}
+
+// prMessages builds the request writing the pull request description of the branch, filling in
+// the pull request template of the repository if there is one.
+func (c *cli) prMessages(lang *locale.Locale, summaries string) ([]*llm.Message, error) {
+	data := c.langData(lang, summaries)
+	data.Template = c.prTemplate
+	return c.render(part{prompt.PR, data})
+}
+
+// releaseMessages builds the request writing the release notes of the range, grouped by the kind of change.
+func (c *cli) releaseMessages(lang *locale.Locale, summaries string) ([]*llm.Message, error) {
+	return c.render(part{prompt.Release, c.langData(lang, summaries)})
+}
+
+// rollupMessages builds the final request in the requested output format.
+func (c *cli) rollupMessages(lang *locale.Locale, summaries string) ([]*llm.Message, error) {
+	switch c.format {
+	case formatRelease:
+		return c.releaseMessages(lang, summaries)
+	case formatJSON:
+		return c.sectionsMessages(lang, summaries)
+	case formatPR:
+		return c.prMessages(lang, summaries)
+	}
+	return c.branchMessages(lang, summaries)
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tetran/lgh/internal/llm"
+)
+
+// gauge tracks the number of calls running at once, and the highest it got to.
+type gauge struct {
+	cur, peak atomic.Int32
+}
+
+func (g *gauge) enter() {
+	n := g.cur.Add(1)
+	for {
+		p := g.peak.Load()
+		if n <= p || g.peak.CompareAndSwap(p, n) {
+			return
+		}
+	}
+}
+
+func (g *gauge) leave() {
+	g.cur.Add(-1)
+}
+
+func TestParallelOrder(t *testing.T) {
+	const n = 8
+	// Each call waits for the next one, so they finish in reverse order.
+	finished := make([]chan struct{}, n+1)
+	for i := range finished {
+		finished[i] = make(chan struct{})
+	}
+	close(finished[n])
+
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+	slots := make([]string, n)
+	err := parallel(context.Background(), n, n, func(ctx context.Context, i int) error {
+		<-finished[i+1]
+		slots[i] = fmt.Sprintf("CS%05d", i+1)
+		mu.Lock()
+		order = append(order, i)
+		mu.Unlock()
+		close(finished[i])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if order[0] != n-1 || order[n-1] != 0 {
+		t.Fatalf("expected the calls to finish in reverse order, got %v", order)
+	}
+	for i, s := range slots {
+		if want := fmt.Sprintf("CS%05d", i+1); s != want {
+			t.Errorf("slot %d: expected %s, got %s", i, want, s)
+		}
+	}
+}
+
+func TestParallelFirstError(t *testing.T) {
+	const limit = 3
+	errFirst := errors.New("first")
+	var running sync.WaitGroup
+	running.Add(limit - 1)
+	var calls atomic.Int32
+	canceled := make([]bool, limit)
+
+	err := parallel(context.Background(), 10, limit, func(ctx context.Context, i int) error {
+		calls.Add(1)
+		if i == 0 {
+			// Fails once the other calls are running.
+			running.Wait()
+			return errFirst
+		}
+		running.Done()
+		<-ctx.Done()
+		canceled[i] = true
+		return fmt.Errorf("call %d: %w", i, ctx.Err())
+	})
+
+	if !errors.Is(err, errFirst) {
+		t.Errorf("expected the first error, got %v", err)
+	}
+	if n := calls.Load(); n != limit {
+		t.Errorf("expected no call to start after the error, got %d calls", n)
+	}
+	for i := 1; i < limit; i++ {
+		if !canceled[i] {
+			t.Errorf("expected call %d to be canceled", i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = parallel(ctx, 10, limit, func(ctx context.Context, i int) error {
+		t.Errorf("unexpected call %d after the context is done", i)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the error of the context, got %v", err)
+	}
+}
+
+func TestParallelLimit(t *testing.T) {
+	const limit = 4
+	var g gauge
+	err := parallel(context.Background(), 50, limit, func(ctx context.Context, i int) error {
+		g.enter()
+		defer g.leave()
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := g.peak.Load(); p > limit {
+		t.Errorf("expected at most %d calls at once, got %d", limit, p)
+	}
+}
+
+// gaugeClient answers after a while, tracking the requests in flight.
+type gaugeClient struct {
+	gauge
+	calls atomic.Int32
+}
+
+func (c *gaugeClient) Chat(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+	c.enter()
+	defer c.leave()
+	c.calls.Add(1)
+	time.Sleep(2 * time.Millisecond)
+	return &llm.Response{Content: "* summary"}, nil
+}
+
+func TestInflightLimit(t *testing.T) {
+	const concurrency = 3
+	client := &gaugeClient{}
+	c := newReduceTestCLI(t, client)
+	c.concurrency = concurrency
+	c.inflight = make(chan struct{}, concurrency)
+
+	// Commits and their files are summarized in parallel at once, as sumCommit does,
+	// so that more calls than the limit want to send a request.
+	err := parallel(context.Background(), 4, c.concurrency, func(ctx context.Context, i int) error {
+		return parallel(ctx, 4, c.concurrency, func(ctx context.Context, j int) error {
+			_, err := c.chat(ctx, []*llm.Message{{Role: llm.RoleUser, Content: "diff"}})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := client.calls.Load(); n != 16 {
+		t.Errorf("expected 16 requests, got %d", n)
+	}
+	if p := client.peak.Load(); p > concurrency {
+		t.Errorf("expected at most %d requests in flight, got %d", concurrency, p)
+	}
+}
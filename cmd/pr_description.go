@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var prCmd = &cobra.Command{
+	Use:   "pr-description",
+	Short: "Write the pull request description of a branch",
+	Long: `Write the pull request description of a branch: motivation, changes, test notes, risk and
+a reviewer checklist. The commits are summarized as in branch-summary, sharing its cache.
+
+When the repository has a pull request template (.github/pull_request_template.md and the
+other places GitHub looks for one), the description fills in its sections instead.`,
+	Args: cobra.NoArgs,
+	Run:  prDescription,
+}
+
+func init() {
+	prCmd.Flags().StringP("base", "b", "", "Base branch (default: base in the config file, or main)")
+	prCmd.Flags().StringP("target", "t", "", "Target branch (default: the current branch)")
+	prCmd.Flags().String("template", "", "Pull request template to fill in (default: the template of the repository, if any)")
+	prCmd.Flags().StringP("output", "o", "", "Also write the description to this file")
+	prCmd.Flags().BoolP("debug", "d", false, "Enable debug mode")
+	prCmd.Flags().IntP("concurrency", "c", 1, "Number of requests sent to the LLM in parallel")
+	prCmd.Flags().Bool("no-cache", false, "Summarize every commit again instead of reusing cached summaries")
+	prCmd.Flags().Bool("resume", false, "Reuse the commit summaries finished by the previous, interrupted run")
+	prCmd.Flags().Duration("timeout", 0, "Time limit of the whole run, e.g. 30m (0: no limit)")
+	prCmd.Flags().Duration("request-timeout", 0, "Time limit of each request to the LLM, e.g. 2m (default: depends on the provider)")
+}
+
+func prDescription(cmd *cobra.Command, args []string) {
+	base, err := cmd.Flags().GetString("base")
+	cobra.CheckErr(err)
+	tgt, err := cmd.Flags().GetString("target")
+	cobra.CheckErr(err)
+	template, err := cmd.Flags().GetString("template")
+	cobra.CheckErr(err)
+
+	cli, ctx, cancel := newCLI(cmd)
+	defer cancel()
+	if tgt == "" {
+		tgt, err = cli.repo.CurrentBranch(ctx)
+		if err != nil {
+			cobra.CheckErr(fmt.Errorf("not a git repository"))
+		}
+	}
+	if base == "" {
+		base = cli.cfg.Base
+	}
+	if base == "" {
+		base = "main"
+	}
+	cli.base, cli.tgt = base, tgt
+	cli.format = formatPR
+
+	err = cli.run(ctx, "pr", func(ctx context.Context, outdir string) error {
+		return cli.describe(ctx, outdir, template)
+	})
+	cobra.CheckErr(err)
+}
+
+// describe writes the pull request description of the branch, filling in the template at path,
+// or the one of the repository when path is empty.
+func (c *cli) describe(ctx context.Context, outdir, path string) error {
+	if path == "" {
+		top, err := c.repo.TopLevel(ctx)
+		if err != nil {
+			return err
+		}
+		path = findPRTemplate(top)
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		c.prTemplate = strings.TrimSpace(string(b))
+		fmt.Fprintf(os.Stderr, "[Template] %s\n", path)
+	}
+
+	_, _, summaries, err := c.summarizeCommits(ctx, outdir)
+	if err != nil {
+		return err
+	}
+	messages, err := c.prMessages(c.langs[0], summaries)
+	if err != nil {
+		return err
+	}
+	res, err := c.chat(ctx, messages)
+	if err != nil {
+		return err
+	}
+	content := unwrapCodeBlock(res.Content) + "\n"
+
+	path = filepath.Join(outdir, "pr.md")
+	if err = c.saveFile(path, content); err != nil {
+		return err
+	}
+	fmt.Print(content)
+	if c.output != "" && c.output != "-" {
+		if err = c.writeOutput(c.output, content); err != nil {
+			return err
+		}
+		path = c.output
+	}
+	fmt.Fprintf(os.Stderr, "[Result file] %s\n", path)
+	return nil
+}
+
+// prTemplatePaths are where GitHub looks for the pull request template, relative to the root of the repository.
+var prTemplatePaths = []string{
+	".github/pull_request_template.md",
+	"pull_request_template.md",
+	"docs/pull_request_template.md",
+}
+
+// findPRTemplate returns the path of the pull request template of the repository, or an empty string.
+// The names are matched case-insensitively, as GitHub does.
+func findPRTemplate(top string) string {
+	for _, p := range prTemplatePaths {
+		dir := filepath.Join(top, filepath.Dir(p))
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() && strings.EqualFold(e.Name(), filepath.Base(p)) {
+				return filepath.Join(dir, e.Name())
+			}
+		}
+	}
+	return ""
+}
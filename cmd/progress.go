@@ -0,0 +1,151 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetran/lgh/internal/git"
+)
+
+// progress shows how far the summary has come. On a terminal it keeps redrawing one status line
+// with the current commit, file, tokens so far and elapsed time; otherwise it prints one dot per commit.
+type progress struct {
+	out    io.Writer
+	live   bool
+	start  time.Time
+	total  int
+	tokens func() int
+
+	mu      sync.Mutex
+	done    int
+	hash    string
+	subject string
+	file    int
+	files   int
+	width   int
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// newProgress starts showing the progress of total commits, of which done are already summarized.
+func newProgress(out *os.File, done, total int, tokens func() int) *progress {
+	p := &progress{
+		out:    out,
+		live:   isTerminal(out),
+		start:  time.Now(),
+		total:  total,
+		done:   done,
+		tokens: tokens,
+		stop:   make(chan struct{}),
+	}
+	if p.live {
+		// Redraw regularly so that the elapsed time moves during long requests.
+		p.stopped.Add(1)
+		go func() {
+			defer p.stopped.Done()
+			t := time.NewTicker(500 * time.Millisecond)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					p.mu.Lock()
+					p.draw()
+					p.mu.Unlock()
+				case <-p.stop:
+					return
+				}
+			}
+		}()
+	}
+	return p
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// commitStarted makes the commit the current one. With concurrency, it is the one started last.
+func (p *progress) commitStarted(commit git.Commit, files int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hash = commit.Hash
+	p.subject = commit.Subject()
+	p.file, p.files = 0, files
+	p.draw()
+}
+
+func (p *progress) fileDone(commit git.Commit) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if commit.Hash == p.hash {
+		p.file++
+	}
+	p.draw()
+}
+
+func (p *progress) commitDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if !p.live {
+		fmt.Fprint(p.out, ".")
+		return
+	}
+	p.draw()
+}
+
+// finish stops the redrawing and leaves the cursor at the start of an empty line.
+// Only the first call has an effect.
+func (p *progress) finish() {
+	p.once.Do(p.doFinish)
+}
+
+func (p *progress) doFinish() {
+	close(p.stop)
+	p.stopped.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.live {
+		p.clear()
+	} else {
+		fmt.Fprintln(p.out)
+	}
+}
+
+// must be called with mu held
+func (p *progress) draw() {
+	if !p.live {
+		return
+	}
+	line := fmt.Sprintf("[%d/%d]", p.done, p.total)
+	if p.hash != "" {
+		subject := p.subject
+		if r := []rune(subject); len(r) > 40 {
+			subject = string(r[:39]) + "…"
+		}
+		line += fmt.Sprintf(" %.7s %s | file %d/%d", p.hash, subject, p.file, p.files)
+	}
+	line += fmt.Sprintf(" | %d tokens | %s", p.tokens(), time.Since(p.start).Truncate(time.Second))
+
+	p.clear()
+	fmt.Fprint(p.out, line)
+	p.width = len([]rune(line))
+}
+
+// must be called with mu held
+func (p *progress) clear() {
+	if p.width > 0 {
+		fmt.Fprintf(p.out, "\r%s\r", strings.Repeat(" ", p.width))
+		p.width = 0
+	}
+}
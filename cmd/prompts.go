@@ -0,0 +1,84 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/tetran/lgh/internal/config"
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/prompt"
+)
+
+var (
+	promptsCmd = &cobra.Command{
+		Use:   "prompts",
+		Short: "Manage the prompt templates",
+		Long: `Manage the prompt templates sent to the model.
+
+The built-in prompts are overridden by text/template files of the same name in
+~/.lgh/prompts/, and those by the files in .lgh/prompts/ of the repository.`,
+	}
+	promptsExportCmd = &cobra.Command{
+		Use:   "export [dir]",
+		Short: "Write the built-in prompt templates to a directory as a starting point",
+		Long: `Write the built-in prompt templates to a directory (default: ~/.lgh/prompts).
+Each template starts with a comment describing the data available to it.
+Delete the files you don't change, so that they keep following the built-in prompts.
+Existing files are kept unless --force is given.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  promptsExport,
+	}
+)
+
+func init() {
+	promptsExportCmd.Flags().Bool("repo", false, "Export to .lgh/prompts of the current repository")
+	promptsExportCmd.Flags().Bool("force", false, "Overwrite existing files")
+	promptsCmd.AddCommand(promptsExportCmd)
+}
+
+func promptsExport(cmd *cobra.Command, args []string) {
+	repo, err := cmd.Flags().GetBool("repo")
+	cobra.CheckErr(err)
+	force, err := cmd.Flags().GetBool("force")
+	cobra.CheckErr(err)
+
+	top := ""
+	if repo {
+		current, err := os.Getwd()
+		cobra.CheckErr(err)
+		top, err = (&git.Repository{Path: current}).TopLevel(cmd.Context())
+		if err != nil {
+			cobra.CheckErr(fmt.Errorf("not a git repository"))
+		}
+	}
+	dirs, err := config.PromptDirs(top, loadConfig().PromptDir)
+	cobra.CheckErr(err)
+
+	dir := dirs[0]
+	if repo {
+		dir = dirs[1]
+	}
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	err = os.MkdirAll(dir, 0755)
+	cobra.CheckErr(err)
+
+	for _, name := range prompt.Names() {
+		path := filepath.Join(dir, name+prompt.Ext)
+		if _, err := os.Stat(path); err == nil && !force {
+			fmt.Printf("Skipped %s (already exists)\n", path)
+			continue
+		}
+		src, err := prompt.Default(name)
+		cobra.CheckErr(err)
+		err = os.WriteFile(path, []byte(src), 0644)
+		cobra.CheckErr(err)
+		fmt.Printf("Wrote %s\n", path)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"github.com/tetran/lgh/internal/anthropic"
+	"github.com/tetran/lgh/internal/config"
+	"github.com/tetran/lgh/internal/llm"
+	"github.com/tetran/lgh/internal/ollama"
+	"github.com/tetran/lgh/internal/openai"
+	"github.com/tetran/lgh/internal/secret"
+)
+
+// loadConfig reads the settings of the provider selected by the `provider` key.
+// Provider specific values are stored as `<provider>-api-key`, `<provider>-model`,
+// `<provider>-base-url` and so on.
+func loadConfig() config.Config {
+	provider := viper.GetString("provider")
+	if provider == "" {
+		provider = config.ProviderOpenAI
+	}
+
+	cfg := config.Config{
+		Provider:      provider,
+		ApiKey:        viper.GetString(provider + "-api-key"),
+		APIKeyCommand: viper.GetString(provider + "-api-key-command"),
+		APIKeyStore:   viper.GetString(provider + "-api-key-store"),
+		Model:         viper.GetString(provider + "-model"),
+		BaseURL:       viper.GetString(provider + "-base-url"),
+		Lang:          viper.GetString("lang"),
+
+		MaxRetries:     llm.DefaultRetryPolicy.MaxRetries,
+		RequestTimeout: viper.GetDuration("request-timeout"),
+		Temperature:    llm.DefaultTemperature,
+
+		Deployment: viper.GetString(provider + "-deployment"),
+		APIVersion: viper.GetString(provider + "-api-version"),
+
+		Base:      viper.GetString("base"),
+		Exclude:   viper.GetStringSlice("exclude"),
+		PromptDir: viper.GetString("prompt-dir"),
+
+		CommitStyle: viper.GetString("commit-style"),
+	}
+	if viper.IsSet("max-retries") {
+		cfg.MaxRetries = viper.GetInt("max-retries")
+	}
+	if cfg.CommitStyle == "" {
+		cfg.CommitStyle = config.StyleConventional
+	}
+	if viper.IsSet("temperature") {
+		cfg.Temperature = viper.GetFloat64("temperature")
+	}
+	if profileConfig.IsSet(provider + "-api-key-store") {
+		cfg.APIKeyName = config.SecretName(provider, profile)
+	} else {
+		cfg.APIKeyName = config.SecretName(provider, "")
+	}
+	if cfg.Model == "" {
+		cfg.Model = config.DefaultModels[provider]
+	}
+	if cfg.Model == "" {
+		cfg.Model = cfg.Deployment
+	}
+	return cfg
+}
+
+// resolveAPIKey reads the API key from the command or the secret store configured for it,
+// unless the key is in the config file.
+func resolveAPIKey(ctx context.Context, cfg *config.Config) error {
+	if cfg.ApiKey != "" {
+		return nil
+	}
+	var err error
+	switch {
+	case cfg.APIKeyCommand != "":
+		cfg.ApiKey, err = secret.Command(ctx, cfg.APIKeyCommand)
+	case cfg.APIKeyStore != "" && cfg.APIKeyStore != config.StoreConfig:
+		var store secret.Store
+		if store, err = secretStore(cfg.APIKeyStore); err != nil {
+			return err
+		}
+		cfg.ApiKey, err = store.Get(cfg.APIKeyName)
+		if errors.Is(err, secret.ErrNotFound) {
+			err = fmt.Errorf("API key `%s` is not in the %s store; set it again with `lgh config set %s-api-key`", cfg.APIKeyName, cfg.APIKeyStore, cfg.Provider)
+		}
+	}
+	return err
+}
+
+func newClient(ctx context.Context, cfg config.Config, debug bool) (llm.Client, error) {
+	if err := resolveAPIKey(ctx, &cfg); err != nil {
+		return nil, err
+	}
+	retry := llm.DefaultRetryPolicy
+	retry.MaxRetries = cfg.MaxRetries
+
+	switch cfg.Provider {
+	case config.ProviderOpenAI:
+		// A custom base URL usually points to a self-hosted server which needs no key.
+		if cfg.ApiKey == "" && cfg.BaseURL == "" {
+			return nil, fmt.Errorf("OpenAI API key is required. Please set it in the config file (using `lgh config init` command)")
+		}
+		return &openai.Client{
+			ApiKey:      cfg.ApiKey,
+			Model:       cfg.Model,
+			BaseURL:     cfg.BaseURL,
+			Timeout:     cfg.RequestTimeout,
+			Retry:       &retry,
+			Temperature: &cfg.Temperature,
+			Debug:       debug,
+		}, nil
+	case config.ProviderAnthropic:
+		if cfg.ApiKey == "" {
+			return nil, fmt.Errorf("Anthropic API key is required. Please set it in the config file (using `lgh config init --provider anthropic` command)")
+		}
+		return &anthropic.Client{
+			ApiKey:      cfg.ApiKey,
+			Model:       cfg.Model,
+			Timeout:     cfg.RequestTimeout,
+			Retry:       &retry,
+			Temperature: &cfg.Temperature,
+			Debug:       debug,
+		}, nil
+	case config.ProviderAzure:
+		if cfg.ApiKey == "" || cfg.BaseURL == "" || cfg.Deployment == "" {
+			return nil, fmt.Errorf("Azure OpenAI API key, endpoint and deployment are required. Please set them in the config file (using `lgh config init --provider azure` command)")
+		}
+		return &openai.Client{
+			ApiKey:      cfg.ApiKey,
+			Model:       cfg.Model,
+			BaseURL:     cfg.BaseURL,
+			Deployment:  cfg.Deployment,
+			APIVersion:  cfg.APIVersion,
+			Timeout:     cfg.RequestTimeout,
+			Retry:       &retry,
+			Temperature: &cfg.Temperature,
+			Debug:       debug,
+		}, nil
+	case config.ProviderOllama:
+		return &ollama.Client{
+			BaseURL:     cfg.BaseURL,
+			Model:       cfg.Model,
+			Timeout:     cfg.RequestTimeout,
+			Retry:       &retry,
+			Temperature: &cfg.Temperature,
+			Debug:       debug,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", cfg.Provider)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tetran/lgh/internal/tokens"
+)
+
+// maxReduceLevels stops reducing when the model keeps answering too long;
+// the roll-up is then sent as it is.
+const maxReduceLevels = 5
+
+// rollupBudget returns how many tokens of commit summaries fit in the roll-up request:
+// half of the context window, leaving the rest for the answer, minus the instructions.
+// The instructions in the pivot language stand for those of every output language.
+func (c *cli) rollupBudget() (int, error) {
+	messages, err := c.rollupMessages(c.langs[0], "")
+	if err != nil {
+		return 0, err
+	}
+	window := tokens.Lookup(c.cfg.Model).ContextWindow
+	overhead := 0
+	for _, m := range messages {
+		overhead += tokens.ForModel(c.cfg.Model).Count(m.Content)
+	}
+	return max(window/2-overhead, minChunkTokens), nil
+}
+
+// reduce shrinks the commit summaries until they fit in the roll-up request.
+// When they are too large, consecutive summaries are grouped into batches that fit in one request,
+// each batch is reduced to one summary, and the same is repeated on the results.
+// The reduced summaries are saved as RD<level>-<batch> next to the CS files.
+func (c *cli) reduce(ctx context.Context, dir string, summaries []string) (string, error) {
+	tok := tokens.ForModel(c.cfg.Model)
+	budget, err := c.rollupBudget()
+	if err != nil {
+		return "", err
+	}
+
+	for level := 1; level <= maxReduceLevels; level++ {
+		sizes := make([]int, len(summaries))
+		total := 0
+		for i, s := range summaries {
+			sizes[i] = tok.Count(s)
+			total += sizes[i]
+		}
+		if total <= budget || (len(summaries) == 1 && level > 1) {
+			break
+		}
+
+		batches := batchBySize(sizes, budget)
+		reduced := make([]string, len(batches))
+		err := parallel(ctx, len(batches), c.concurrency, func(ctx context.Context, i int) error {
+			b := batches[i]
+			messages, err := c.reduceMessages(strings.Join(summaries[b[0]:b[1]], ""))
+			if err != nil {
+				return err
+			}
+			res, err := c.chat(ctx, messages)
+			if err != nil {
+				return err
+			}
+			reduced[i] = res.Content + "\n"
+			return c.saveFile(filepath.Join(dir, fmt.Sprintf("RD%d-%05d", level, i+1)), reduced[i])
+		})
+		if err != nil {
+			return "", err
+		}
+		if c.debug {
+			fmt.Fprintf(os.Stderr, "\n## Reduced %d summaries into %d (level %d)\n", len(summaries), len(reduced), level)
+		}
+		summaries = reduced
+	}
+
+	return strings.Join(summaries, ""), nil
+}
+
+// batchBySize groups consecutive items into [start, end) ranges whose total size fits in the budget.
+// Every batch holds at least two items when possible, so that each level makes progress.
+func batchBySize(sizes []int, budget int) [][2]int {
+	var batches [][2]int
+	start, size := 0, 0
+	for i, n := range sizes {
+		if i-start >= 2 && size+n > budget {
+			batches = append(batches, [2]int{start, i})
+			start, size = i, 0
+		}
+		size += n
+	}
+	if start < len(sizes) {
+		batches = append(batches, [2]int{start, len(sizes)})
+	}
+	return batches
+}
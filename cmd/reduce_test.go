@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tetran/lgh/internal/config"
+	"github.com/tetran/lgh/internal/llm"
+	"github.com/tetran/lgh/internal/locale"
+	"github.com/tetran/lgh/internal/prompt"
+	"github.com/tetran/lgh/internal/tokens"
+)
+
+func TestBatchBySize(t *testing.T) {
+	tests := []struct {
+		name   string
+		sizes  []int
+		budget int
+		want   [][2]int
+	}{
+		{"empty", nil, 10, nil},
+		{"single item larger than the budget", []int{20}, 10, [][2]int{{0, 1}}},
+		{"exact boundary", []int{5, 5}, 10, [][2]int{{0, 2}}},
+		{"one over the boundary", []int{5, 5, 1}, 10, [][2]int{{0, 2}, {2, 3}}},
+		{"at least two items", []int{20, 20, 20}, 10, [][2]int{{0, 2}, {2, 3}}},
+		{"last batch", []int{3, 3, 3, 3}, 6, [][2]int{{0, 2}, {2, 4}}},
+	}
+	for _, tt := range tests {
+		if got := batchBySize(tt.sizes, tt.budget); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeClient answers the requests with the given answers in turn, and then with the last one.
+type fakeClient struct {
+	mu       sync.Mutex
+	answers  []string
+	requests []string
+}
+
+func (f *fakeClient) Chat(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, messages[len(messages)-1].Content)
+	answer := f.answers[min(len(f.requests), len(f.answers))-1]
+	return &llm.Response{Content: answer}, nil
+}
+
+func newReduceTestCLI(t *testing.T, client llm.Client) *cli {
+	t.Helper()
+	prompts, err := prompt.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	en, err := locale.Lookup("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &cli{
+		client:      client,
+		cfg:         config.Config{Model: "gpt-4"},
+		langs:       []*locale.Locale{en},
+		concurrency: 1,
+		limiter:     &llm.RateLimiter{},
+		inflight:    make(chan struct{}, 1),
+		prompts:     prompts,
+	}
+}
+
+// textOf returns a text of n tokens: each word is one.
+func textOf(n int) string {
+	return strings.Repeat("word ", n)
+}
+
+func TestReduce(t *testing.T) {
+	budget, err := newReduceTestCLI(t, nil).rollupBudget()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		client := &fakeClient{answers: []string{"reduced"}}
+		got, err := newReduceTestCLI(t, client).reduce(context.Background(), t.TempDir(), nil)
+		if err != nil || got != "" || len(client.requests) != 0 {
+			t.Errorf("got %q, %v after %d requests", got, err, len(client.requests))
+		}
+	})
+
+	t.Run("exact boundary", func(t *testing.T) {
+		client := &fakeClient{answers: []string{"reduced"}}
+		summaries := []string{textOf(budget / 2), textOf(budget - budget/2)}
+		if n := tokens.ForModel("gpt-4").Count(strings.Join(summaries, "")); n != budget {
+			t.Fatalf("expected %d tokens, got %d", budget, n)
+		}
+		got, err := newReduceTestCLI(t, client).reduce(context.Background(), t.TempDir(), summaries)
+		if err != nil || got != strings.Join(summaries, "") || len(client.requests) != 0 {
+			t.Errorf("expected the summaries as they are, got %d requests, %v", len(client.requests), err)
+		}
+
+		summaries[1] += textOf(1)
+		got, err = newReduceTestCLI(t, client).reduce(context.Background(), t.TempDir(), summaries)
+		if err != nil || got != "reduced\n" || len(client.requests) != 1 {
+			t.Errorf("expected one reduction over the budget, got %d requests, %v", len(client.requests), err)
+		}
+	})
+
+	t.Run("single item larger than the budget", func(t *testing.T) {
+		// The model keeps answering too long; the single summary is not reduced again.
+		client := &fakeClient{answers: []string{textOf(budget * 2)}}
+		got, err := newReduceTestCLI(t, client).reduce(context.Background(), t.TempDir(), []string{textOf(budget * 2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(client.requests) != 1 || got != client.answers[0]+"\n" {
+			t.Errorf("expected one reduction, got %d requests", len(client.requests))
+		}
+	})
+
+	t.Run("multiple levels", func(t *testing.T) {
+		// Four summaries make two batches, whose answers are still too long together,
+		// and are reduced into one document at the second level.
+		client := &fakeClient{answers: []string{textOf(budget * 3 / 5), textOf(budget * 3 / 5), "final"}}
+		dir := t.TempDir()
+		summaries := make([]string, 4)
+		for i := range summaries {
+			summaries[i] = textOf(budget * 2 / 5)
+		}
+		got, err := newReduceTestCLI(t, client).reduce(context.Background(), dir, summaries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "final\n" || len(client.requests) != 3 {
+			t.Errorf("expected one document after 3 requests, got %q after %d", got, len(client.requests))
+		}
+		for _, name := range []string{"RD1-00001", "RD1-00002", "RD2-00001"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tetran/lgh/internal/git"
+)
+
+var releaseNotesCmd = &cobra.Command{
+	Use:   "release-notes [range]",
+	Short: "Write the release notes of a range of commits",
+	Long: `Write the release notes of a range of commits, grouped into Features, Fixes,
+Breaking Changes and Internal.
+
+The range is "from..to", "from.." (up to HEAD) or a single revision, which is the start of
+the range up to HEAD. Any revision works: tags, branches, hashes or @{upstream}.
+It defaults to the latest tag up to HEAD; when HEAD is tagged itself, the range starts
+at the tag before it.
+
+The commits of the range are followed along the first parent, and the commits a merge
+brought in are summarized too, so that a merged pull request is described as one change.
+The commits are summarized as in branch-summary, sharing its cache.`,
+	Example: `  lgh release-notes
+  lgh release-notes v1.2.0..v1.3.0
+  lgh release-notes @{upstream}..`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  releaseNotes,
+}
+
+func init() {
+	releaseNotesCmd.Flags().StringP("output", "o", "", "Also write the release notes to this file")
+	releaseNotesCmd.Flags().BoolP("debug", "d", false, "Enable debug mode")
+	releaseNotesCmd.Flags().IntP("concurrency", "c", 1, "Number of requests sent to the LLM in parallel")
+	releaseNotesCmd.Flags().Bool("no-cache", false, "Summarize every commit again instead of reusing cached summaries")
+	releaseNotesCmd.Flags().Bool("resume", false, "Reuse the commit summaries finished by the previous, interrupted run")
+	releaseNotesCmd.Flags().Duration("timeout", 0, "Time limit of the whole run, e.g. 30m (0: no limit)")
+	releaseNotesCmd.Flags().Duration("request-timeout", 0, "Time limit of each request to the LLM, e.g. 2m (default: depends on the provider)")
+}
+
+func releaseNotes(cmd *cobra.Command, args []string) {
+	cli, ctx, cancel := newCLI(cmd)
+	defer cancel()
+	if !cli.repo.IsGitRepository(ctx) {
+		cobra.CheckErr(fmt.Errorf("not a git repository"))
+	}
+	var rng string
+	if len(args) > 0 {
+		rng = args[0]
+	}
+	from, to, err := releaseRange(ctx, cli.repo, rng)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if from == "" {
+		fmt.Fprintf(os.Stderr, "[Range] %s (no tag is reachable; the whole history)\n", to)
+	} else {
+		fmt.Fprintf(os.Stderr, "[Range] %s..%s\n", from, to)
+	}
+	cli.base, cli.tgt = from, to
+	cli.format = formatRelease
+
+	err = cli.run(ctx, "release", cli.writeReleaseNotes)
+	cobra.CheckErr(err)
+}
+
+// releaseRange splits the range argument of release-notes into its start and end.
+// A missing end is HEAD, and a missing start is the latest tag before the end, or empty when there is none.
+func releaseRange(ctx context.Context, repo *git.Repository, rng string) (from, to string, err error) {
+	if strings.Contains(rng, "...") {
+		return "", "", fmt.Errorf("symmetric ranges (`%s`) are not supported; use from..to", rng)
+	}
+	from, to, ok := strings.Cut(rng, "..")
+	if !ok {
+		from, to = rng, ""
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	if from != "" || ok {
+		if from == "" {
+			return "", "", fmt.Errorf("the range `%s` has no start; use from..to", rng)
+		}
+		return from, to, nil
+	}
+
+	tag, err := repo.LatestTag(ctx, to)
+	if err != nil {
+		return "", to, nil
+	}
+	// A tagged end is the release itself, whose notes start at the previous tag.
+	tagged, err := repo.ResolveCommit(ctx, tag)
+	if err != nil {
+		return "", "", err
+	}
+	end, err := repo.ResolveCommit(ctx, to)
+	if err != nil {
+		return "", "", err
+	}
+	if tagged == end {
+		if tag, err = repo.LatestTag(ctx, to+"^"); err != nil {
+			return "", to, nil
+		}
+	}
+	return tag, to, nil
+}
+
+// writeReleaseNotes writes the release notes of the range.
+func (c *cli) writeReleaseNotes(ctx context.Context, outdir string) error {
+	_, _, summaries, err := c.summarizeCommits(ctx, outdir)
+	if err != nil {
+		return err
+	}
+	messages, err := c.releaseMessages(c.langs[0], summaries)
+	if err != nil {
+		return err
+	}
+	res, err := c.chat(ctx, messages)
+	if err != nil {
+		return err
+	}
+	content := unwrapCodeBlock(res.Content) + "\n"
+
+	path := filepath.Join(outdir, "release-notes.md")
+	if err = c.saveFile(path, content); err != nil {
+		return err
+	}
+	fmt.Print(content)
+	if c.output != "" && c.output != "-" {
+		if err = c.writeOutput(c.output, content); err != nil {
+			return err
+		}
+		path = c.output
+	}
+	fmt.Fprintf(os.Stderr, "[Result file] %s\n", path)
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/llm"
+	"github.com/tetran/lgh/internal/locale"
+	"github.com/tetran/lgh/internal/report"
+)
+
+// Output formats of branch-summary, the pull request description of pr-description
+// and the release notes of release-notes.
+const (
+	formatText    = "text"
+	formatJSON    = "json"
+	formatPR      = "pr"
+	formatRelease = "release"
+)
+
+var sectionsSchema = &llm.Schema{Name: "branch_summary", Schema: report.SectionsSchema}
+
+// rollupSections makes the final summary as sections, using the structured output of the provider
+// when it has one. Other providers only get the format in the prompt, so their answer is validated too.
+func (c *cli) rollupSections(ctx context.Context, lang *locale.Locale, summaries string) ([]report.Section, error) {
+	messages, err := c.sectionsMessages(lang, summaries)
+	if err != nil {
+		return nil, err
+	}
+	var res *llm.Response
+	if s, ok := c.client.(llm.StructuredClient); ok {
+		res, err = c.send(ctx, messages, func(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+			return s.ChatJSON(ctx, messages, sectionsSchema)
+		})
+	} else {
+		res, err = c.chat(ctx, messages)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSections(res.Content)
+}
+
+// parseSections decodes the sections answered by the model.
+func parseSections(content string) ([]report.Section, error) {
+	content = unwrapCodeBlock(content)
+	if err := report.Validate(sectionsSchema.Schema, []byte(content)); err != nil {
+		return nil, fmt.Errorf("the model did not answer in the expected JSON format: %w", err)
+	}
+	var answer struct {
+		Sections []report.Section `json:"sections"`
+	}
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return nil, err
+	}
+	for i := range answer.Sections {
+		if answer.Sections[i].Items == nil {
+			answer.Sections[i].Items = []string{}
+		}
+	}
+	if answer.Sections == nil {
+		answer.Sections = []report.Section{}
+	}
+	return answer.Sections, nil
+}
+
+// unwrapCodeBlock returns the content of the answer without the Markdown code block around it.
+// Some models wrap their answer in one even when asked not to.
+func unwrapCodeBlock(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") || !strings.HasSuffix(content, "```") {
+		return content
+	}
+	content = strings.TrimSuffix(content, "```")
+	// The opening line may name the language, e.g. ```json.
+	if _, rest, ok := strings.Cut(content, "\n"); ok {
+		return strings.TrimSpace(rest)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(content, "```"))
+}
+
+// branchReport builds the JSON document of the run. The file summaries are read from the cache,
+// where every summary is stored, so commits reused by --resume are reported in full as well.
+func (c *cli) branchReport(
+	ctx context.Context,
+	commits []git.Commit,
+	summaries []string,
+	sections []report.Section,
+) (*report.BranchSummary, error) {
+	mergeBase, err := c.repo.MergeBase(ctx, c.base, c.tgt)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &report.BranchSummary{
+		Base:      c.base,
+		Target:    c.tgt,
+		MergeBase: mergeBase,
+		Commits:   make([]report.Commit, 0, len(commits)),
+		Sections:  sections,
+		Usage: report.Usage{
+			PromptTokens:     c.usage.PromptTokens,
+			CompletionTokens: c.usage.CompletionTokens,
+			TotalTokens:      c.usage.Total(),
+		},
+	}
+	for i, commit := range commits {
+		rc := report.Commit{
+			Hash:    commit.Hash,
+			Author:  commit.Author,
+			Date:    commit.Date,
+			Subject: commit.Subject(),
+			Merge:   commit.IsMerge,
+			Files:   make([]report.File, 0, len(commit.Diffs)),
+			Summary: strings.TrimSpace(summaries[i]),
+		}
+		for _, diff := range commit.Diffs {
+			sum, _ := c.cache.Get(c.fileKey(commit, diff))
+			rc.Files = append(rc.Files, report.File{
+				Path:    diff.Path,
+				Status:  fileStatus(diff),
+				Summary: strings.TrimSpace(sum),
+			})
+		}
+		rep.Commits = append(rep.Commits, rc)
+	}
+	return rep, nil
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSections(t *testing.T) {
+	sections, err := parseSections("```json\n{\"sections\": [{\"title\": \"Features\", \"items\": [\"Add X\"]}]}\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 1 || sections[0].Title != "Features" || sections[0].Items[0] != "Add X" {
+		t.Errorf("unexpected sections %+v", sections)
+	}
+
+	tests := map[string]string{
+		`{"sections": [{"title": "", "items": ["Add X"]}]}`: "$.sections[0].title: shorter than 1",
+		`{"sections": [{"title": "Features"}]}`:             `missing required property "items"`,
+		`not JSON`:                                          "invalid JSON",
+	}
+	for content, want := range tests {
+		if _, err := parseSections(content); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", content, want, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tetran/lgh/internal/git"
+)
+
+const manifestFile = "run.json"
+
+// runManifest records which commit each CS file of the output directory belongs to,
+// so that an interrupted run can be resumed with `--resume`.
+type runManifest struct {
+	Base   string `json:"base"`
+	Target string `json:"target"`
+	// Commits holds the hash of the commit summarized in each CS file, oldest first:
+	// CS<n> is the summary of Commits[n-1]. The hash is recorded only once the file is written,
+	// so an empty hash marks a file which is missing or left over from an earlier run.
+	Commits []string `json:"commits"`
+
+	mu sync.Mutex
+}
+
+func newRunManifest(base, target string, num int) *runManifest {
+	return &runManifest{Base: base, Target: target, Commits: make([]string, num)}
+}
+
+func loadRunManifest(dir string) (*runManifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("no previous run to resume in %s", dir)
+		}
+		return nil, err
+	}
+	m := &runManifest{}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("broken %s in %s: %w", manifestFile, dir, err)
+	}
+	return m, nil
+}
+
+func (m *runManifest) save(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, manifestFile), string(b))
+}
+
+// done records that CS<fnum> is the summary of the commit, and saves the manifest.
+func (m *runManifest) done(dir string, fnum int, commit git.Commit) error {
+	m.mu.Lock()
+	m.Commits[fnum-1] = commit.Hash
+	m.mu.Unlock()
+	return m.save(dir)
+}
+
+// finished returns the summary saved as CS<fnum> by the previous run, if it was made for the same commit.
+func (m *runManifest) finished(dir string, fnum int, commit git.Commit) (string, bool) {
+	if fnum < 1 || fnum > len(m.Commits) || m.Commits[fnum-1] != commit.Hash {
+		return "", false
+	}
+	b, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("CS%05d", fnum)))
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// writeFileAtomic writes the file via a temporary file, so that an interrupted run
+// never leaves a partially written result behind.
+func writeFileAtomic(path, content string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tetran/lgh/internal/cache"
+	"github.com/tetran/lgh/internal/git"
+	"github.com/tetran/lgh/internal/llm"
+)
+
+// countingClient answers each request with a new answer, and fails the requests containing failOn.
+type countingClient struct {
+	mu     sync.Mutex
+	n      int
+	failOn string
+}
+
+func (f *countingClient) Chat(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failOn != "" && strings.Contains(messages[len(messages)-1].Content, f.failOn) {
+		return nil, errors.New("interrupted")
+	}
+	f.n++
+	return &llm.Response{Content: fmt.Sprintf("* answer %d", f.n)}, nil
+}
+
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+func commitFile(t *testing.T, dir, name, content string, args ...string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "add", name)
+	gitRun(t, dir, append([]string{"commit", "-q"}, args...)...)
+}
+
+func TestResumeAfterRewrite(t *testing.T) {
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "-q", "-b", "main")
+	gitRun(t, dir, "config", "user.email", "test@example.com")
+	gitRun(t, dir, "config", "user.name", "Test")
+	commitFile(t, dir, "a.txt", "a\n", "-m", "Initial commit")
+	gitRun(t, dir, "checkout", "-q", "-b", "feature")
+	commitFile(t, dir, "b.txt", "b\n", "-m", "Add b")
+	commitFile(t, dir, "c.txt", "c\n", "-m", "Add c")
+
+	client := &countingClient{}
+	c := newReduceTestCLI(t, client)
+	c.repo = &git.Repository{Path: dir}
+	c.base, c.tgt = "main", "feature"
+	c.cache = &cache.Cache{Dir: t.TempDir()}
+	c.noCache = true
+	outdir := t.TempDir()
+	ctx := context.Background()
+
+	if _, _, _, err := c.summarizeCommits(ctx, outdir); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := os.ReadFile(filepath.Join(outdir, "CS00002"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last commit is amended, and the run resuming the previous one is interrupted at it.
+	commitFile(t, dir, "c.txt", "rewritten\n", "--amend", "-m", "Add c")
+	client.failOn = "rewritten"
+	c.resume = true
+	if _, _, _, err = c.summarizeCommits(ctx, outdir); err == nil {
+		t.Fatal("expected the run to be interrupted")
+	}
+
+	// The CS file of the amended commit is left over from the first run, and must not be resumed.
+	client.failOn = ""
+	_, summaries, _, err := c.summarizeCommits(ctx, outdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summaries[0] == string(stale) {
+		t.Errorf("the summary of the amended commit was resumed from the earlier run: %q", summaries[0])
+	}
+	first, err := os.ReadFile(filepath.Join(outdir, "CS00001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summaries[1] != string(first) {
+		t.Errorf("expected the summary of the unchanged commit to be resumed, got %q", summaries[1])
+	}
+
+	m, err := loadRunManifest(outdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := c.repo.CommitsOnBranch(ctx, "feature", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Commits[0] != commits[1].Hash || m.Commits[1] != commits[0].Hash {
+		t.Errorf("unexpected manifest %v", m.Commits)
+	}
+}
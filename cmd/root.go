@@ -4,30 +4,47 @@ Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/tetran/lgh/internal/config"
+	"github.com/tetran/lgh/internal/git"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var (
 	cfgFile string
+	profile string
 
 	rootCmd = &cobra.Command{
 		Use:   "lgh",
 		Short: "lgh is a tool to help you understand a git repository better.",
 		Long:  ``,
+		// The layers over the config file need to know the command:
+		// `lgh config init|set --profile NAME` creates the profile instead of using it.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			err := loadProfile(cmd != configInitCmd && cmd != configSetCmd)
+			cobra.CheckErr(err)
+			err = loadRepoConfig()
+			cobra.CheckErr(err)
+		},
 	}
 )
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The context given to the commands is canceled on SIGINT or SIGTERM, which stops
+// requests in flight and running git processes.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -37,9 +54,16 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", fmt.Sprintf("config file (default is $HOME/%s/config.yaml)", config.WorkDir))
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "configuration profile (default is $"+config.ProfileEnv+")")
 
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(bsCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(promptsCmd)
+	rootCmd.AddCommand(commitMsgCmd)
+	rootCmd.AddCommand(hookCmd)
+	rootCmd.AddCommand(prCmd)
+	rootCmd.AddCommand(releaseNotesCmd)
 }
 
 func initConfig() {
@@ -56,9 +80,80 @@ func initConfig() {
 		viper.SetConfigName("config")
 	}
 
+	viper.SetEnvPrefix(config.EnvPrefix)
+	viper.SetEnvKeyReplacer(config.EnvReplacer)
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
+
+// profileConfig holds the values of the selected profile, if any.
+var profileConfig = viper.New()
+
+// loadProfile merges the profile selected by --profile or $LGH_PROFILE over the top-level values
+// of the config file. Profiles are stored under `profiles.<name>` and may set any key.
+// A profile which doesn't exist is an error when it is required.
+func loadProfile(required bool) error {
+	if profile == "" {
+		profile = os.Getenv(config.ProfileEnv)
+	}
+	if profile == "" {
+		return nil
+	}
+
+	values, ok := viper.Get(config.ProfileKey(profile)).(map[string]any)
+	if !ok {
+		if required {
+			return fmt.Errorf("unknown profile: %s", profile)
+		}
+		return nil
+	}
+	if err := profileConfig.MergeConfigMap(values); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Using profile:", profile)
+	return viper.MergeConfigMap(values)
+}
+
+// repoConfig holds the values of the repository configuration, if one was found.
+var repoConfig = viper.New()
+
+// loadRepoConfig merges the configuration file at the root of the current repository
+// over the user's configuration. Keys which a repository can't set are ignored with a warning,
+// so that the commands fixing the file still run.
+func loadRepoConfig() error {
+	current, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	top, err := (&git.Repository{Path: current}).TopLevel(context.Background())
+	if err != nil {
+		// Not in a repository
+		return nil
+	}
+
+	file := filepath.Join(top, config.RepoFile)
+	if _, err = os.Stat(file); err != nil {
+		return nil
+	}
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+	if err = v.ReadInConfig(); err != nil {
+		return err
+	}
+	repoConfig.SetConfigFile(file)
+	for _, key := range v.AllKeys() {
+		if err = config.CheckRepoKey(key); err != nil {
+			fmt.Fprintf(os.Stderr, "[Ignored] %s: %v\n", file, err)
+			continue
+		}
+		repoConfig.Set(key, v.Get(key))
+	}
+
+	fmt.Fprintln(os.Stderr, "Using repository config file:", file)
+	return viper.MergeConfigMap(repoConfig.AllSettings())
+}
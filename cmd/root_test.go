@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/tetran/lgh/internal/config"
+)
+
+const profileTestConfig = `
+provider: openai
+openai-model: gpt-4o
+lang: ja
+base: develop
+profiles:
+  work:
+    provider: anthropic
+    anthropic-model: claude-work
+    anthropic-api-key-store: keyring
+  local:
+    openai-model: llama-local
+    openai-base-url: http://localhost:8000/v1
+`
+
+// setProfileTestConfig replaces the global config with the test config, for the duration of the test.
+func setProfileTestConfig(t *testing.T, name, env string) {
+	t.Helper()
+	reset := func() {
+		viper.Reset()
+		profileConfig = viper.New()
+		profile = ""
+	}
+	reset()
+	t.Cleanup(reset)
+
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(profileTestConfig)); err != nil {
+		t.Fatal(err)
+	}
+	profile = name
+	t.Setenv(config.ProfileEnv, env)
+}
+
+func TestLoadProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		flag     string
+		env      string
+		provider string
+		model    string
+		baseURL  string
+		keyName  string
+	}{
+		{"no profile", "", "", "openai", "gpt-4o", "", "openai-api-key"},
+		{"profile over global", "work", "", "anthropic", "claude-work", "", "work/anthropic-api-key"},
+		{"partial profile", "local", "", "openai", "llama-local", "http://localhost:8000/v1", "openai-api-key"},
+		{"profile from the environment", "", "work", "anthropic", "claude-work", "", "work/anthropic-api-key"},
+		{"flag over the environment", "local", "work", "openai", "llama-local", "http://localhost:8000/v1", "openai-api-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setProfileTestConfig(t, tt.flag, tt.env)
+			if err := loadProfile(true); err != nil {
+				t.Fatal(err)
+			}
+			cfg := loadConfig()
+			if cfg.Provider != tt.provider || cfg.Model != tt.model || cfg.BaseURL != tt.baseURL || cfg.APIKeyName != tt.keyName {
+				t.Errorf("unexpected config %+v", cfg)
+			}
+			// The values the profile doesn't set come from the top level.
+			if cfg.Lang != "ja" || cfg.Base != "develop" {
+				t.Errorf("expected the top-level lang and base, got %s and %s", cfg.Lang, cfg.Base)
+			}
+		})
+	}
+}
+
+func TestLoadUnknownProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		flag     string
+		env      string
+		required bool
+		wantErr  string
+	}{
+		{"from the flag", "missing", "", true, "unknown profile: missing"},
+		{"from the environment", "", "missing", true, "unknown profile: missing"},
+		// `lgh config init --profile NAME` creates the profile.
+		{"not required", "missing", "", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setProfileTestConfig(t, tt.flag, tt.env)
+			err := loadProfile(tt.required)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg := loadConfig(); cfg.Provider != "openai" || cfg.Model != "gpt-4o" {
+				t.Errorf("expected the top-level config, got %+v", cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2024 Koichi Kaneshige <coarse.ground@gmail.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/tetran/lgh/internal/config"
+	"github.com/tetran/lgh/internal/secret"
+)
+
+// secretStore returns the store of API keys named in the config.
+func secretStore(name string) (secret.Store, error) {
+	switch name {
+	case config.StoreKeyring:
+		if !secret.KeyringAvailable() {
+			return nil, fmt.Errorf("no system secret store is available; use the `%s` store instead", config.StoreFile)
+		}
+		return secret.Keyring{}, nil
+	case config.StoreFile:
+		path, err := config.SecretsFile()
+		if err != nil {
+			return nil, err
+		}
+		return &secret.File{Path: path, Passphrase: readPassphrase}, nil
+	}
+	return nil, fmt.Errorf("unknown API key store: %s (available: %s, %s, %s)", name, config.StoreKeyring, config.StoreFile, config.StoreConfig)
+}
+
+// readPassphrase takes the passphrase of the secrets file from $LGH_PASSPHRASE,
+// or asks for it on the terminal without echoing it.
+func readPassphrase() (string, error) {
+	if p, ok := os.LookupEnv(config.PassphraseEnv); ok {
+		return p, nil
+	}
+	if !isTerminal(os.Stdin) {
+		return "", fmt.Errorf("the passphrase of the secrets file is required; set $%s", config.PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase of the secrets file: ")
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err == io.EOF {
+		return "", fmt.Errorf("no passphrase was given; type it or set $%s", config.PassphraseEnv)
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,349 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tetran/lgh/internal/llm"
+)
+
+const (
+	defaultBaseURL   = "https://api.anthropic.com"
+	apiVersion       = "2023-06-01"
+	defaultMaxTokens = 4096
+	// maxTemperature is the highest temperature the Messages API accepts. Other providers go up to 2.
+	maxTemperature = 1.0
+
+	DefaultTimeout = 60 * time.Second
+)
+
+type MessagesRequest struct {
+	Model       string      `json:"model"`
+	System      string      `json:"system,omitempty"`
+	Messages    []*Message  `json:"messages"`
+	MaxTokens   int         `json:"max_tokens"`
+	Temperature float64     `json:"temperature"`
+	Stream      bool        `json:"stream,omitempty"`
+	Tools       []*Tool     `json:"tools,omitempty"`
+	ToolChoice  *ToolChoice `json:"tool_choice,omitempty"`
+}
+
+// Tool is a tool the model may call. lgh uses a single forced tool to get structured answers.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type MessagesResponse struct {
+	Content    []*ContentBlock `json:"content"`
+	StopReason string          `json:"stop_reason"`
+	Usage      *Usage          `json:"usage"`
+}
+
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	// Input is the argument of a tool_use block.
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type Client struct {
+	ApiKey    string
+	Model     string
+	MaxTokens int
+	// Timeout limits each attempt of a request. Zero uses DefaultTimeout.
+	Timeout time.Duration
+	// Retry overrides llm.DefaultRetryPolicy when set.
+	Retry *llm.RetryPolicy
+	// Temperature overrides llm.DefaultTemperature when set.
+	Temperature *float64
+	Debug       bool
+
+	// baseURL replaces defaultBaseURL, for the tests.
+	baseURL string
+}
+
+func (c *Client) Chat(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+	return c.chat(ctx, c.newRequest(messages))
+}
+
+// ChatJSON implements llm.StructuredClient. The Messages API has no JSON mode, so the model
+// is forced to call a tool whose input schema is the given schema; the input is the answer.
+func (c *Client) ChatJSON(ctx context.Context, messages []*llm.Message, schema *llm.Schema) (*llm.Response, error) {
+	mreq := c.newRequest(messages)
+	mreq.Tools = []*Tool{{
+		Name:        schema.Name,
+		Description: "Report the answer in the required structure.",
+		InputSchema: schema.Schema,
+	}}
+	mreq.ToolChoice = &ToolChoice{Type: "tool", Name: schema.Name}
+	return c.chat(ctx, mreq)
+}
+
+func (c *Client) chat(ctx context.Context, mreq *MessagesRequest) (*llm.Response, error) {
+	res, err := c.send(ctx, mreq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	mres := &MessagesResponse{}
+	err = json.NewDecoder(res.Body).Decode(&mres)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Debug {
+		mres.print()
+	}
+
+	return mres.toResponse(), nil
+}
+
+// StreamEvent is one of the server-sent events of a streamed response.
+// Only the fields lgh needs are decoded.
+type StreamEvent struct {
+	Type    string            `json:"type"`
+	Message *MessagesResponse `json:"message"`
+	Delta   *struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage *Usage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ChatStream implements llm.Streamer using server-sent events.
+func (c *Client) ChatStream(ctx context.Context, messages []*llm.Message, onDelta func(string)) (*llm.Response, error) {
+	mreq := c.newRequest(messages)
+	mreq.Stream = true
+	res, err := c.send(ctx, mreq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var text strings.Builder
+	mres := &MessagesResponse{Usage: &Usage{}}
+	err = llm.ReadSSE(res.Body, func(_, data string) error {
+		ev := &StreamEvent{}
+		if err := json.Unmarshal([]byte(data), ev); err != nil {
+			return err
+		}
+		switch ev.Type {
+		case "message_start":
+			if ev.Message != nil && ev.Message.Usage != nil {
+				mres.Usage.InputTokens = ev.Message.Usage.InputTokens
+			}
+		case "content_block_delta":
+			if ev.Delta != nil && ev.Delta.Type == "text_delta" {
+				text.WriteString(ev.Delta.Text)
+				onDelta(ev.Delta.Text)
+			}
+		case "message_delta":
+			// The output tokens are cumulative.
+			if ev.Usage != nil {
+				mres.Usage.OutputTokens = ev.Usage.OutputTokens
+			}
+		case "error":
+			// e.g. the API got overloaded in the middle of the stream
+			apiErr := &llm.APIError{StatusCode: http.StatusOK}
+			if ev.Error != nil {
+				apiErr.Type = ev.Error.Type
+				apiErr.Message = ev.Error.Message
+			}
+			return apiErr
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	mres.Content = []*ContentBlock{{Type: "text", Text: text.String()}}
+
+	if c.Debug {
+		mres.print()
+	}
+
+	return mres.toResponse(), nil
+}
+
+func (c *Client) send(ctx context.Context, mreq *MessagesRequest) (*http.Response, error) {
+	base := c.baseURL
+	if base == "" {
+		base = defaultBaseURL
+	}
+	url := base + "/v1/messages"
+	if c.Debug {
+		mreq.print()
+	}
+	body, err := json.Marshal(mreq)
+	if err != nil {
+		return nil, err
+	}
+
+	// The timeout applies to each attempt, including reading a streamed answer.
+	client := &http.Client{
+		Timeout: c.timeout(),
+	}
+	return c.retryPolicy().Do(ctx, client, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodPost,
+			url,
+			bytes.NewReader(body),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-api-key", c.ApiKey)
+		req.Header.Set("anthropic-version", apiVersion)
+		return req, nil
+	}, parseError)
+}
+
+// newRequest converts the messages into the shape the Messages API expects.
+// System messages are lifted into the top-level system prompt, and consecutive
+// messages of the same role are joined because the API requires the roles to alternate.
+func (c *Client) newRequest(messages []*llm.Message) *MessagesRequest {
+	maxTokens := c.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultMaxTokens
+	}
+	mreq := &MessagesRequest{
+		Model:       c.Model,
+		MaxTokens:   maxTokens,
+		Temperature: c.temperature(),
+	}
+
+	var systems []string
+	for _, m := range messages {
+		if m.Role == llm.RoleSystem {
+			systems = append(systems, m.Content)
+			continue
+		}
+		if n := len(mreq.Messages); n > 0 && mreq.Messages[n-1].Role == m.Role {
+			mreq.Messages[n-1].Content += "\n\n" + m.Content
+			continue
+		}
+		mreq.Messages = append(mreq.Messages, &Message{Role: m.Role, Content: m.Content})
+	}
+	mreq.System = strings.Join(systems, "\n\n")
+
+	return mreq
+}
+
+func (r *MessagesResponse) toResponse() *llm.Response {
+	var texts []string
+	for _, b := range r.Content {
+		switch b.Type {
+		case "text":
+			texts = append(texts, b.Text)
+		case "tool_use":
+			// A forced tool call is the whole answer.
+			return r.withUsage(&llm.Response{Content: string(b.Input)})
+		}
+	}
+	return r.withUsage(&llm.Response{Content: strings.Join(texts, "")})
+}
+
+func (r *MessagesResponse) withUsage(res *llm.Response) *llm.Response {
+	if r.Usage != nil {
+		res.Usage = llm.Usage{
+			PromptTokens:     r.Usage.InputTokens,
+			CompletionTokens: r.Usage.OutputTokens,
+		}
+	}
+	return res
+}
+
+func (r *MessagesRequest) print() {
+	fmt.Fprintf(os.Stderr, "\n## Messages Request\n")
+	fmt.Fprintln(os.Stderr, "### Model")
+	fmt.Fprintln(os.Stderr, r.Model)
+	fmt.Fprintln(os.Stderr, "### System")
+	fmt.Fprintln(os.Stderr, r.System)
+	fmt.Fprintln(os.Stderr, "### Prompts")
+	for _, m := range r.Messages {
+		fmt.Fprintf(os.Stderr, "- %s \n%s\n", m.Role, m.Content)
+	}
+}
+
+func (r *MessagesResponse) print() {
+	fmt.Fprintf(os.Stderr, "\n## Messages Response\n")
+	fmt.Fprintf(os.Stderr, "### Content\n%s\n", r.toResponse().Content)
+	if r.Usage == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr,
+		"\n### Usages\ntotal: %d (input: %d, output: %d)\n",
+		r.Usage.InputTokens+r.Usage.OutputTokens,
+		r.Usage.InputTokens,
+		r.Usage.OutputTokens)
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+// temperature is clamped to the range of the Messages API, which rejects higher values
+// that are valid for the other providers.
+func (c *Client) temperature() float64 {
+	if c.Temperature != nil {
+		return min(*c.Temperature, maxTemperature)
+	}
+	return llm.DefaultTemperature
+}
+
+func (c *Client) retryPolicy() llm.RetryPolicy {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	return llm.DefaultRetryPolicy
+}
+
+// parseError reads the `{"type": "error", "error": {...}}` body returned by the Messages API.
+func parseError(res *http.Response) *llm.APIError {
+	apiErr := &llm.APIError{}
+	var body struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return apiErr
+	}
+	apiErr.Type = body.Error.Type
+	apiErr.Message = body.Error.Message
+	return apiErr
+}
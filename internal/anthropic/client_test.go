@@ -0,0 +1,258 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetran/lgh/internal/llm"
+)
+
+var noRetry = &llm.RetryPolicy{}
+
+func TestNewRequest(t *testing.T) {
+	c := &Client{Model: "claude-test"}
+	req := c.newRequest([]*llm.Message{
+		{Role: llm.RoleSystem, Content: "persona"},
+		{Role: llm.RoleSystem, Content: "overview"},
+		{Role: llm.RoleUser, Content: "first"},
+		{Role: llm.RoleUser, Content: "second"},
+	})
+
+	if req.System != "persona\n\noverview" {
+		t.Fatalf("unexpected system prompt: %q", req.System)
+	}
+	if len(req.Messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(req.Messages))
+	}
+	if req.Messages[0].Role != llm.RoleUser || req.Messages[0].Content != "first\n\nsecond" {
+		t.Fatalf("unexpected message: %+v", req.Messages[0])
+	}
+	if req.MaxTokens != defaultMaxTokens {
+		t.Fatalf("expected max_tokens %d, got %d", defaultMaxTokens, req.MaxTokens)
+	}
+}
+
+func TestTemperature(t *testing.T) {
+	tests := []struct {
+		temperature *float64
+		want        float64
+	}{
+		{nil, llm.DefaultTemperature},
+		{ptr(0.2), 0.2},
+		{ptr(1), 1},
+		{ptr(1.5), 1},
+	}
+	for _, tt := range tests {
+		c := &Client{Model: "claude-test", Temperature: tt.temperature}
+		if got := c.newRequest([]*llm.Message{{Role: llm.RoleUser, Content: "hi"}}).Temperature; got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.temperature, got, tt.want)
+		}
+	}
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
+
+func TestToResponseToolUse(t *testing.T) {
+	r := &MessagesResponse{
+		Content: []*ContentBlock{
+			{Type: "text", Text: "Here is the summary."},
+			{Type: "tool_use", Input: []byte(`{"sections":[]}`)},
+		},
+		Usage: &Usage{InputTokens: 10, OutputTokens: 5},
+	}
+	res := r.toResponse()
+	if res.Content != `{"sections":[]}` {
+		t.Fatalf("unexpected content: %q", res.Content)
+	}
+	if res.Usage.Total() != 15 {
+		t.Fatalf("expected 15 tokens, got %d", res.Usage.Total())
+	}
+}
+
+func TestChat(t *testing.T) {
+	var got MessagesRequest
+	answer := `{"content": [{"type": "text", "text": "summary"}], "stop_reason": "end_turn", "usage": {"input_tokens": 10, "output_tokens": 5}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "sk-ant" || r.Header.Get("anthropic-version") != apiVersion {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		got = MessagesRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(answer))
+	}))
+	defer srv.Close()
+
+	c := &Client{ApiKey: "sk-ant", Model: "claude-test", Retry: noRetry, baseURL: srv.URL}
+	messages := []*llm.Message{
+		{Role: llm.RoleSystem, Content: "persona"},
+		{Role: llm.RoleUser, Content: "diff"},
+	}
+	res, err := c.Chat(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "summary" || res.Usage.PromptTokens != 10 || res.Usage.CompletionTokens != 5 {
+		t.Errorf("unexpected response %+v", res)
+	}
+	// The system prompt is a top-level field, not a message.
+	if got.Model != "claude-test" || got.System != "persona" || got.Stream || got.Tools != nil {
+		t.Errorf("unexpected request %+v", got)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Role != llm.RoleUser || got.Messages[0].Content != "diff" {
+		t.Errorf("unexpected messages %+v", got.Messages)
+	}
+
+	answer = `{"content": [{"type": "tool_use", "name": "sections", "input": {"sections": []}}], "stop_reason": "tool_use"}`
+	schema := json.RawMessage(`{"type":"object"}`)
+	res, err = c.ChatJSON(context.Background(), messages, &llm.Schema{Name: "sections", Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != `{"sections": []}` {
+		t.Errorf("expected the tool input as the answer, got %q", res.Content)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Name != "sections" || string(got.Tools[0].InputSchema) != string(schema) {
+		t.Errorf("unexpected tools %+v", got.Tools)
+	}
+	if got.ToolChoice == nil || got.ToolChoice.Type != "tool" || got.ToolChoice.Name != "sections" {
+		t.Errorf("expected the tool to be forced, got %+v", got.ToolChoice)
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req MessagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream {
+			t.Errorf("expected a streamed request, got %+v (%v)", req, err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`event: message_start
+data: {"type": "message_start", "message": {"content": [], "usage": {"input_tokens": 10, "output_tokens": 1}}}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "sum"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "mary"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 0}
+
+event: message_delta
+data: {"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 2}}
+
+event: message_stop
+data: {"type": "message_stop"}
+
+`))
+	}))
+	defer srv.Close()
+
+	c := &Client{ApiKey: "sk-ant", Model: "claude-test", Retry: noRetry, baseURL: srv.URL}
+	var deltas []string
+	res, err := c.ChatStream(context.Background(), []*llm.Message{{Role: llm.RoleUser, Content: "diff"}}, func(s string) {
+		deltas = append(deltas, s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "summary" || strings.Join(deltas, "|") != "sum|mary" {
+		t.Errorf("unexpected response %+v, deltas %q", res, deltas)
+	}
+	if res.Usage.PromptTokens != 10 || res.Usage.CompletionTokens != 2 {
+		t.Errorf("unexpected usage %+v", res.Usage)
+	}
+}
+
+func TestChatError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		typ        string
+		message    string
+		retryAfter time.Duration
+	}{
+		{
+			name:    "invalid request",
+			status:  http.StatusBadRequest,
+			body:    `{"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens: Field required"}}`,
+			typ:     "invalid_request_error",
+			message: "max_tokens: Field required",
+		},
+		{
+			name:       "rate limited",
+			status:     http.StatusTooManyRequests,
+			header:     http.Header{"Retry-After": {"7"}},
+			body:       `{"type": "error", "error": {"type": "rate_limit_error", "message": "Number of request tokens has exceeded your per-minute rate limit"}}`,
+			typ:        "rate_limit_error",
+			message:    "per-minute rate limit",
+			retryAfter: 7 * time.Second,
+		},
+		{
+			name:   "not JSON",
+			status: http.StatusBadGateway,
+			body:   `<html>Bad Gateway</html>`,
+		},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range tt.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+
+		c := &Client{ApiKey: "sk-ant", Model: "claude-test", Retry: noRetry, baseURL: srv.URL}
+		_, err := c.Chat(context.Background(), []*llm.Message{{Role: llm.RoleUser, Content: "diff"}})
+		var apiErr *llm.APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: expected an API error, got %v", tt.name, err)
+		} else if apiErr.StatusCode != tt.status || apiErr.Type != tt.typ || !strings.Contains(apiErr.Message, tt.message) || apiErr.RetryAfter != tt.retryAfter {
+			t.Errorf("%s: unexpected error %+v", tt.name, apiErr)
+		}
+		srv.Close()
+	}
+}
+
+func TestChatStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "sum"}}
+
+event: error
+data: {"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}
+
+`))
+	}))
+	defer srv.Close()
+
+	c := &Client{ApiKey: "sk-ant", Model: "claude-test", Retry: noRetry, baseURL: srv.URL}
+	_, err := c.ChatStream(context.Background(), []*llm.Message{{Role: llm.RoleUser, Content: "diff"}}, func(string) {})
+	var apiErr *llm.APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != "overloaded_error" || apiErr.Message != "Overloaded" {
+		t.Errorf("expected the error event as an API error, got %v", err)
+	}
+}
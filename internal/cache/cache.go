@@ -0,0 +1,99 @@
+// Package cache stores LLM outputs on disk so that re-runs only pay for what changed.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Cache struct {
+	Dir string
+}
+
+// Key derives a cache key from everything that influences the cached output.
+func Key(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h[:])
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// Get returns the cached content of the key. A hit refreshes the modification time,
+// so that Prune removes the entries which have not been used for a while.
+func (c *Cache) Get(key string) (string, bool) {
+	p := c.path(key)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", false
+	}
+	t := time.Now()
+	_ = os.Chtimes(p, t, t)
+	return string(b), true
+}
+
+// Has reports whether the key is cached, without counting it as a use as Get does.
+func (c *Cache) Has(key string) bool {
+	_, err := os.Stat(c.path(key))
+	return err == nil
+}
+
+// Put stores the content of the key. The file is renamed into place,
+// so that a concurrent or interrupted run never sees a partial entry.
+func (c *Cache) Put(key, content string) error {
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Prune removes the entries not used for longer than olderThan and returns how many were removed.
+// Zero removes everything.
+func (c *Cache) Prune(olderThan time.Duration) (int, error) {
+	deadline := time.Now().Add(-olderThan)
+	removed := 0
+	err := filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if olderThan > 0 && info.ModTime().After(deadline) {
+			return nil
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := &Cache{Dir: t.TempDir()}
+	key := Key("file", "openai", "gpt-4o", "abc123", "main.go")
+
+	if _, ok := c.Get(key); ok || c.Has(key) {
+		t.Fatal("expected a miss on an empty cache")
+	}
+	if err := c.Put(key, "summary"); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := c.Get(key); !ok || v != "summary" {
+		t.Fatalf("expected a hit with %q, got %q (%v)", "summary", v, ok)
+	}
+	if Key("file", "openai", "gpt-4o", "abc123", "main.go") != key {
+		t.Fatal("expected the key to be stable")
+	}
+	if Key("file", "openai", "gpt-4o", "abc124", "main.go") == key {
+		t.Fatal("expected a different key for a different commit")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	c := &Cache{Dir: t.TempDir()}
+	old, fresh := Key("old"), Key("fresh")
+	for _, k := range []string{old, fresh} {
+		if err := c.Put(k, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(c.path(old), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 entry to be pruned, got %d", n)
+	}
+	if _, ok := c.Get(old); ok {
+		t.Fatal("expected the old entry to be removed")
+	}
+	if _, ok := c.Get(fresh); !ok {
+		t.Fatal("expected the fresh entry to be kept")
+	}
+
+	if n, err = c.Prune(0); err != nil || n != 1 {
+		t.Fatalf("expected the remaining entry to be pruned, got %d (%v)", n, err)
+	}
+}
+
+func TestHas(t *testing.T) {
+	c := &Cache{Dir: t.TempDir()}
+	key := Key("unused")
+	if err := c.Put(key, "summary"); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(c.path(key), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Has(key) {
+		t.Fatal("expected a hit")
+	}
+	// Looking the key up doesn't keep it from being pruned.
+	info, err := os.Stat(c.path(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Fatalf("expected the modification time to be kept, got %v", info.ModTime())
+	}
+}
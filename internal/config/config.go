@@ -1,29 +1,208 @@
 package config
 
-import "strings"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetran/lgh/internal/locale"
+)
 
 const WorkDir = ".lgh"
 
-type Config struct {
-	ApiKey string
-	Lang   string
+// CacheDir returns the directory where summaries are cached across runs.
+func CacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, WorkDir, "cache"), nil
+}
+
+// PromptDirs returns the directories whose templates override the built-in prompts:
+// the user's, and the one of the repository at top, which takes precedence.
+// repoDir replaces the default directory of the repository, .lgh/prompts; a relative path is
+// relative to top.
+func PromptDirs(top, repoDir string) ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	if repoDir == "" {
+		repoDir = filepath.Join(WorkDir, "prompts")
+	}
+	if !filepath.IsAbs(repoDir) {
+		repoDir = filepath.Join(top, repoDir)
+	}
+	return []string{filepath.Join(home, WorkDir, "prompts"), repoDir}, nil
 }
 
-var languages = map[string]string{
-	"en": "English",
-	"ja": "Japanese",
+// EnvPrefix is the prefix of the environment variables which override the config file.
+// Without it, common variables like $LANG would override the keys of the same name.
+const EnvPrefix = "LGH"
+
+// EnvReplacer turns a key into the rest of the name of its environment variable.
+var EnvReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// EnvVar returns the environment variable which overrides the key, e.g. LGH_OPENAI_MODEL for openai-model.
+func EnvVar(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(EnvReplacer.Replace(key))
 }
 
-func (c *Config) FullLang() string {
-	if lang, ok := languages[c.Lang]; ok {
-		return lang
+// ProfileEnv selects the profile when no --profile flag is given.
+const ProfileEnv = "LGH_PROFILE"
+
+// ProfileKey is the key under which the values of the named profile are stored in the config file.
+func ProfileKey(name string) string {
+	return "profiles." + name
+}
+
+// Where API keys are kept
+const (
+	StoreConfig  = "config"
+	StoreKeyring = "keyring"
+	StoreFile    = "file"
+)
+
+// PassphraseEnv holds the passphrase of the encrypted secrets file on machines where it can't be typed.
+const PassphraseEnv = "LGH_PASSPHRASE"
+
+// SecretsFile returns the encrypted file keeping API keys when there is no system secret store.
+func SecretsFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
 	}
+	return filepath.Join(home, WorkDir, "secrets.enc"), nil
+}
+
+// SecretName is the name of the API key of the provider in a secret store.
+// Keys of profiles are kept apart from the top-level one.
+func SecretName(provider, profile string) string {
+	if profile == "" {
+		return provider + "-api-key"
+	}
+	return profile + "/" + provider + "-api-key"
+}
+
+// RepoFile is the repository configuration, at the root of the working tree.
+// Its values take precedence over the user's configuration file.
+const RepoFile = ".lgh.yaml"
+
+// repoKeys are the keys allowed in RepoFile. Repositories are shared, so their configuration
+// must not hold secrets, nor point the requests, which carry the user's API key, to another server.
+var repoKeys = map[string]bool{
+	"base":            true,
+	"lang":            true,
+	"exclude":         true,
+	"prompt-dir":      true,
+	"provider":        true,
+	"max-retries":     true,
+	"request-timeout": true,
+	"temperature":     true,
+	"commit-style":    true,
+}
 
-	for k, v := range languages {
-		if strings.HasPrefix(c.Lang, k) {
-			return v
+// CheckRepoKey returns an error if the key can't be set in RepoFile.
+func CheckRepoKey(key string) error {
+	if repoKeys[key] {
+		return nil
+	}
+	for provider := range DefaultModels {
+		if key == provider+"-model" {
+			return nil
 		}
 	}
+	if IsSecret(key) {
+		return fmt.Errorf("%s must not contain secrets (`%s`); set it in ~/%s/config.yaml instead", RepoFile, key, WorkDir)
+	}
+	return fmt.Errorf("`%s` can't be set in %s; set it in ~/%s/config.yaml instead", key, RepoFile, WorkDir)
+}
+
+// IsSecret reports whether the value of the key is a secret, which is never shown in full.
+func IsSecret(key string) bool {
+	return strings.HasSuffix(key, "-api-key")
+}
+
+// StyleConventional is the default style of commit messages, Conventional Commits.
+const StyleConventional = "conventional"
+
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+	ProviderAzure     = "azure"
+)
+
+// DefaultModels is the model used for each provider when none is configured.
+var DefaultModels = map[string]string{
+	ProviderOpenAI:    "gpt-3.5-turbo",
+	ProviderAnthropic: "claude-3-5-haiku-latest",
+	ProviderOllama:    "llama3",
+	// Azure OpenAI selects the model by the deployment, so the model name is informational.
+	ProviderAzure: "",
+}
+
+type Config struct {
+	Provider string
+	ApiKey   string
+	// APIKeyCommand prints the API key, when it is not in the config file.
+	APIKeyCommand string
+	// APIKeyStore is where the API key is kept instead of the config file: StoreKeyring or StoreFile.
+	// APIKeyName is its name there.
+	APIKeyStore string
+	APIKeyName  string
+	Model       string
+	BaseURL     string
+	Lang        string
+
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// RequestTimeout limits each request. Zero uses the provider's default.
+	RequestTimeout time.Duration
+	// Temperature is the sampling temperature of the model.
+	Temperature float64
 
-	return "English"
+	// Azure OpenAI only
+	Deployment string
+	APIVersion string
+
+	// Base is the default base branch of branch-summary. Empty means "main".
+	Base string
+	// Exclude lists the paths, in .gitignore style, whose changes are not summarized.
+	Exclude []string
+	// PromptDir replaces the prompt templates directory of the repository.
+	PromptDir string
+	// CommitStyle is the style of the messages drafted by commit-msg:
+	// StyleConventional, or a description of the style for the model to follow.
+	CommitStyle string
+}
+
+// Locale returns the output language. An empty Lang means locale.Default.
+func (c *Config) Locale() (*locale.Locale, error) {
+	lang := c.Lang
+	if lang == "" {
+		lang = locale.Default
+	}
+	return locale.Lookup(lang)
+}
+
+// FullLang returns the name of the output language, or English when the language is unknown.
+func (c *Config) FullLang() string {
+	l, err := c.Locale()
+	if err != nil {
+		return "English"
+	}
+	return l.Name
+}
+
+// LangHint returns the writing conventions of the output language to mention in the prompts.
+func (c *Config) LangHint() string {
+	l, err := c.Locale()
+	if err != nil {
+		return ""
+	}
+	return l.Hint
 }
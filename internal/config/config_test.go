@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRepoKey(t *testing.T) {
+	for _, key := range []string{"base", "lang", "exclude", "provider", "anthropic-model"} {
+		if err := CheckRepoKey(key); err != nil {
+			t.Errorf("%s: unexpected error %v", key, err)
+		}
+	}
+
+	tests := map[string]string{
+		"openai-api-key":  "must not contain secrets",
+		"openai-base-url": "can't be set",
+		"unknown":         "can't be set",
+	}
+	for key, want := range tests {
+		if err := CheckRepoKey(key); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", key, want, err)
+		}
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	tests := map[string]string{
+		"lang":            "LGH_LANG",
+		"openai-model":    "LGH_OPENAI_MODEL",
+		"request-timeout": "LGH_REQUEST_TIMEOUT",
+	}
+	for key, want := range tests {
+		if got := EnvVar(key); got != want {
+			t.Errorf("%s: got %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestPromptDirs(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	tests := []struct {
+		repoDir string
+		want    string
+	}{
+		{"", "/repo/.lgh/prompts"},
+		{"prompts", "/repo/prompts"},
+		{"/shared/prompts", "/shared/prompts"},
+	}
+	for _, tt := range tests {
+		dirs, err := PromptDirs("/repo", tt.repoDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dirs[0] != filepath.FromSlash("/home/user/.lgh/prompts") || dirs[1] != filepath.FromSlash(tt.want) {
+			t.Errorf("%q: unexpected dirs %v", tt.repoDir, dirs)
+		}
+	}
+}
+
+func TestLookupKey(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       any
+	}{
+		{"provider", "anthropic", "anthropic"},
+		{"lang", "pt_br", "pt-BR"},
+		{"exclude", "vendor/, *.lock ,", []string{"vendor/", "*.lock"}},
+		{"max-retries", "3", 3},
+		{"temperature", "0.2", 0.2},
+		{"request-timeout", "2m", "2m"},
+		{"azure-deployment", "gpt4o", "gpt4o"},
+	}
+	for _, tt := range tests {
+		k, err := LookupKey(tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := k.Parse(tt.value)
+		if err != nil {
+			t.Errorf("%s=%s: unexpected error %v", tt.key, tt.value, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s=%s: expected %v, got %v", tt.key, tt.value, tt.want, got)
+		}
+	}
+
+	invalid := map[string]string{
+		"provider":        "gemini",
+		"lang":            "xx",
+		"max-retries":     "-1",
+		"temperature":     "3",
+		"request-timeout": "soon",
+		"openai-base-url": "localhost:8080",
+	}
+	for key, value := range invalid {
+		k, err := LookupKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := k.Parse(value); err == nil {
+			t.Errorf("%s=%s: expected an error", key, value)
+		}
+	}
+
+	for _, key := range []string{"unknown", "ollama-api-key", "anthropic-base-url"} {
+		if _, err := LookupKey(key); err == nil {
+			t.Errorf("%s: expected an error", key)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tetran/lgh/internal/locale"
+)
+
+// Key describes a setting of the config file.
+type Key struct {
+	Name        string
+	Description string
+	// parse checks the value given on the command line and converts it to the type stored in the file.
+	parse func(value string) (any, error)
+}
+
+// Parse checks the value and converts it to the type stored in the config file.
+func (k *Key) Parse(value string) (any, error) {
+	v, err := k.parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %w", k.Name, err)
+	}
+	return v, nil
+}
+
+// providerKeys are the settings each provider has, with their description.
+var providerKeys = map[string][]string{
+	ProviderOpenAI:    {"api-key", "api-key-command", "api-key-store", "model", "base-url"},
+	ProviderAnthropic: {"api-key", "api-key-command", "api-key-store", "model"},
+	ProviderOllama:    {"model", "base-url"},
+	ProviderAzure:     {"api-key", "api-key-command", "api-key-store", "model", "base-url", "deployment", "api-version"},
+}
+
+var keys = func() map[string]*Key {
+	m := map[string]*Key{}
+	add := func(name, description string, parse func(string) (any, error)) {
+		m[name] = &Key{Name: name, Description: description, parse: parse}
+	}
+
+	providers := make([]string, 0, len(DefaultModels))
+	for p := range DefaultModels {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+	add("provider", "LLM provider ("+strings.Join(providers, "/")+")", oneOf(providers...))
+	add("lang", "Output language, a BCP-47 tag such as en, ja or pt-BR", func(v string) (any, error) {
+		l, err := locale.Lookup(v)
+		if err != nil {
+			return nil, err
+		}
+		return l.Tag, nil
+	})
+	add("base", "Default base branch of branch-summary", nonEmpty)
+	add("exclude", "Comma separated paths, in .gitignore style, whose changes are not summarized", func(v string) (any, error) {
+		var patterns []string
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				patterns = append(patterns, p)
+			}
+		}
+		return patterns, nil
+	})
+	add("commit-style", "Style of the messages drafted by commit-msg: "+StyleConventional+" (default), or a description of the style", nonEmpty)
+	add("prompt-dir", "Prompt templates directory of the repository (default: .lgh/prompts)", nonEmpty)
+	add("max-retries", "Number of times a failed request is retried", func(v string) (any, error) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q is not a number of 0 or more", v)
+		}
+		return n, nil
+	})
+	add("request-timeout", "Time limit of each request, e.g. 2m", func(v string) (any, error) {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%q is not a duration such as 90s or 2m", v)
+		}
+		return v, nil
+	})
+	add("temperature", "Sampling temperature of the model, from 0 to 2 (up to 1 with Anthropic)", func(v string) (any, error) {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 2 {
+			return nil, fmt.Errorf("%q is not a number from 0 to 2", v)
+		}
+		return f, nil
+	})
+
+	for provider, names := range providerKeys {
+		for _, name := range names {
+			key := provider + "-" + name
+			switch name {
+			case "api-key":
+				add(key, "API key (prefer a secret store or a key command)", nonEmpty)
+			case "api-key-command":
+				add(key, "Command printing the API key, e.g. pass show "+provider, nonEmpty)
+			case "api-key-store":
+				add(key, "Where the API key is kept ("+StoreKeyring+"/"+StoreFile+"/"+StoreConfig+")", oneOf(StoreKeyring, StoreFile, StoreConfig))
+			case "model":
+				add(key, "Model", nonEmpty)
+			case "base-url":
+				add(key, "Base URL of the API", func(v string) (any, error) {
+					u, err := url.Parse(v)
+					if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+						return nil, fmt.Errorf("%q is not an http(s) URL", v)
+					}
+					return v, nil
+				})
+			case "deployment":
+				add(key, "Deployment name", nonEmpty)
+			case "api-version":
+				add(key, "API version, e.g. 2024-06-01", nonEmpty)
+			}
+		}
+	}
+	return m
+}()
+
+// LookupKey returns the description of a setting. Keys of profiles are given without the
+// `profiles.<name>.` prefix.
+func LookupKey(name string) (*Key, error) {
+	k, ok := keys[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown key: %s (see `lgh config set --help`)", name)
+	}
+	return k, nil
+}
+
+// Keys returns all the settings, sorted by name.
+func Keys() []*Key {
+	ret := make([]*Key, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, k)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+func nonEmpty(v string) (any, error) {
+	if v == "" {
+		return nil, fmt.Errorf("the value is empty")
+	}
+	return v, nil
+}
+
+func oneOf(values ...string) func(string) (any, error) {
+	return func(v string) (any, error) {
+		for _, allowed := range values {
+			if v == allowed {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of %s", v, strings.Join(values, ", "))
+	}
+}
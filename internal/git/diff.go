@@ -0,0 +1,106 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// StagedDiff returns the changes staged in the index, against HEAD.
+func (r *Repository) StagedDiff(ctx context.Context) ([]FileDiff, error) {
+	return r.diff(ctx, "--cached")
+}
+
+// WorkingTreeDiff returns the changes in the working tree which are not staged.
+func (r *Repository) WorkingTreeDiff(ctx context.Context) ([]FileDiff, error) {
+	return r.diff(ctx)
+}
+
+// diff runs git diff with the given arguments. Renames are shown as a deletion and an addition,
+// so that every change has one path and its full content.
+func (r *Repository) diff(ctx context.Context, args ...string) ([]FileDiff, error) {
+	args = append([]string{"diff", "--no-color", "--no-ext-diff", "--no-renames"}, args...)
+	output, err := r.execGit(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseDiff(output)
+}
+
+// parseDiff parses the output of git diff. The file headers are only looked for before the first hunk
+// of each file, so removed lines which look like `--- ` headers are kept as content.
+func parseDiff(output []byte) ([]FileDiff, error) {
+	buf := []byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(buf, 2048*1024)
+
+	var diffs []FileDiff
+	var current *FileDiff
+	inHunks := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			if current != nil {
+				diffs = append(diffs, *current)
+			}
+			current = &FileDiff{Path: diffPath(strings.TrimPrefix(line, "diff --git "))}
+			inHunks = false
+		case current == nil:
+			// Nothing comes before the first file.
+		case inHunks:
+			current.DiffContents = append(current.DiffContents, line)
+		case strings.HasPrefix(line, "@@"):
+			inHunks = true
+			current.DiffContents = append(current.DiffContents, line)
+		case strings.HasPrefix(line, "index "):
+			before, after, ok := strings.Cut(strings.Fields(line)[1], "..")
+			if ok {
+				current.IndexBefore, current.IndexAfter = before, after
+			}
+		case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+			// Quoted paths can't be split from the diff line, so they are taken from these headers.
+			if current.Path == "" {
+				current.Path = headerPath(line[4:])
+			}
+		default:
+			current.DiffContents = append(current.DiffContents, line)
+		}
+	}
+	if current != nil {
+		diffs = append(diffs, *current)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// diffPath returns the path of `a/PATH b/PATH`, or an empty string when the paths are quoted or differ.
+func diffPath(paths string) string {
+	n := (len(paths) - len("a/ b/")) / 2
+	if n <= 0 || len(paths) != 2*n+len("a/ b/") || !strings.HasPrefix(paths, "a/") {
+		return ""
+	}
+	a, b := paths[2:2+n], paths[2+n:]
+	if b != " b/"+a {
+		return ""
+	}
+	return a
+}
+
+// headerPath returns the path of a `--- a/PATH` or `+++ b/PATH` header, which is empty for /dev/null.
+func headerPath(s string) string {
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, `"`) {
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			s = unquoted
+		}
+	}
+	return s[min(2, len(s)):]
+}
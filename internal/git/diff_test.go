@@ -0,0 +1,94 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	output := `diff --git a/dir/a b.txt b/dir/a b.txt
+index 1111111..2222222 100644
+--- a/dir/a b.txt
++++ b/dir/a b.txt
+@@ -1,2 +1,2 @@
+ keep
+--- removed line which looks like a header
++++ added line which looks like a header
+diff --git "a/\343\201\202.txt" "b/\343\201\202.txt"
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ "b/\343\201\202.txt"
+@@ -0,0 +1 @@
++new
+`
+	diffs, err := parseDiff([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileDiff{
+		{
+			Path:        "dir/a b.txt",
+			IndexBefore: "1111111",
+			IndexAfter:  "2222222",
+			DiffContents: []string{
+				"@@ -1,2 +1,2 @@",
+				" keep",
+				"--- removed line which looks like a header",
+				"+++ added line which looks like a header",
+			},
+		},
+		{
+			Path:         "あ.txt",
+			IndexBefore:  "0000000",
+			IndexAfter:   "3333333",
+			DiffContents: []string{"new file mode 100644", "@@ -0,0 +1 @@", "+new"},
+		},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("unexpected diffs:\n%#v", diffs)
+	}
+}
+
+func TestStagedDiff(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := initTestRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := createCommit(dir, "test.txt", "initial content\n", "Initial commit"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "test.txt"), []byte("staged content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execGit(dir, "add", "test.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "test.txt"), []byte("unstaged content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &Repository{Path: dir}
+	staged, err := repo.StagedDiff(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 1 || staged[0].Path != "test.txt" {
+		t.Fatalf("unexpected staged diffs: %#v", staged)
+	}
+	if _, hunks := staged[0].Hunks(); len(hunks) != 1 || hunks[0][2] != "+staged content" {
+		t.Errorf("unexpected staged hunks: %#v", hunks)
+	}
+
+	unstaged, err := repo.WorkingTreeDiff(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unstaged) != 1 || unstaged[0].DiffContents[2] != "+unstaged content" {
+		t.Errorf("unexpected working tree diffs: %#v", unstaged)
+	}
+}
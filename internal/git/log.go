@@ -3,6 +3,7 @@ package git
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -19,6 +20,8 @@ type Commit struct {
 	IsMerge bool
 	Message string
 	Diffs   []FileDiff
+	// Merged is the commits brought in by a merge, newest first. Only CommitsInRange sets it.
+	Merged []Commit
 }
 
 type FileDiff struct {
@@ -28,26 +31,25 @@ type FileDiff struct {
 	DiffContents []string
 }
 
-func (r *Repository) CommitsOnBranch(branch, parent string) ([]Commit, error) {
+func (r *Repository) CommitsOnBranch(ctx context.Context, branch, parent string) ([]Commit, error) {
 	// check if the branch exists
-	_, err := r.execGit("rev-parse", "--verify", branch)
+	_, err := r.execGit(ctx, "rev-parse", "--verify", branch)
 	if err != nil {
 		return nil, fmt.Errorf("branch `%s` does not exist", branch)
 	}
 	// check if the parent exists
-	_, err = r.execGit("rev-parse", "--verify", parent)
+	_, err = r.execGit(ctx, "rev-parse", "--verify", parent)
 	if err != nil {
 		return nil, fmt.Errorf("parent branch `%s` does not exist", parent)
 	}
 
-	out, err := r.execGit("merge-base", parent, branch)
+	base, err := r.MergeBase(ctx, parent, branch)
 	if err != nil {
 		return nil, err
 	}
 
-	base := strings.TrimSpace(string(out))
 	revs := base + ".." + branch
-	output, err := r.execGit("log", "--first-parent", "-p", "--no-color", revs)
+	output, err := r.execGit(ctx, "log", "--first-parent", "-p", "--no-color", revs)
 	if err != nil {
 		return nil, err
 	}
@@ -55,13 +57,51 @@ func (r *Repository) CommitsOnBranch(branch, parent string) ([]Commit, error) {
 	return r.parseLog(output)
 }
 
-func (r *Repository) IsGitRepository() bool {
-	_, err := r.execGit("rev-parse", "--is-inside-work-tree")
+// MergeBase returns the hash of the best common ancestor of the two revisions.
+func (r *Repository) MergeBase(ctx context.Context, a, b string) (string, error) {
+	out, err := r.execGit(ctx, "merge-base", a, b)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// TopLevel returns the absolute path of the root of the working tree.
+func (r *Repository) TopLevel(ctx context.Context) (string, error) {
+	out, err := r.execGit(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// CurrentBranch returns the name of the branch checked out, or "HEAD" when it is detached.
+func (r *Repository) CurrentBranch(ctx context.Context) (string, error) {
+	out, err := r.execGit(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GitPath returns the absolute path of a file in the git directory, e.g. "hooks".
+// It follows the settings which move such files, like core.hooksPath, and works in linked worktrees.
+func (r *Repository) GitPath(ctx context.Context, name string) (string, error) {
+	out, err := r.execGit(ctx, "rev-parse", "--path-format=absolute", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (r *Repository) IsGitRepository(ctx context.Context) bool {
+	_, err := r.execGit(ctx, "rev-parse", "--is-inside-work-tree")
 	return err == nil
 }
 
-func (r *Repository) execGit(args ...string) ([]byte, error) {
-	cmd := exec.Command("git", args...)
+// execGit runs git in the repository. The process is killed when the context is done.
+func (r *Repository) execGit(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = r.Path
 	return cmd.Output()
 }
@@ -132,3 +172,30 @@ func (r *Repository) parseLog(output []byte) ([]Commit, error) {
 
 	return commits, nil
 }
+
+// Subject returns the first line of the commit message.
+func (c Commit) Subject() string {
+	for _, line := range strings.Split(c.Message, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Hunks splits the diff contents into the header lines (file mode changes and the like)
+// and the hunks, each of which starts with its `@@` line.
+func (d FileDiff) Hunks() (header []string, hunks [][]string) {
+	for _, line := range d.DiffContents {
+		if strings.HasPrefix(line, "@@") {
+			hunks = append(hunks, []string{line})
+			continue
+		}
+		if len(hunks) == 0 {
+			header = append(header, line)
+			continue
+		}
+		hunks[len(hunks)-1] = append(hunks[len(hunks)-1], line)
+	}
+	return header, hunks
+}
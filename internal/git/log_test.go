@@ -1,9 +1,11 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -42,7 +44,7 @@ func TestCommitsOnBranch(t *testing.T) {
 	cmdOutput, _ := cmd.Output()
 	fmt.Printf("Branches: %s\n", cmdOutput)
 
-	commits, err := repo.CommitsOnBranch(branch, defaultBranch)
+	commits, err := repo.CommitsOnBranch(context.Background(), branch, defaultBranch)
 	if err != nil {
 		t.Fatalf("LogsOnBranch failed: %v", err)
 	}
@@ -59,7 +61,7 @@ func TestCommitsOnBranch(t *testing.T) {
 	}
 
 	// Call the LogsOnBranch function again with the test branch name
-	commits, err = repo.CommitsOnBranch(branch, defaultBranch)
+	commits, err = repo.CommitsOnBranch(context.Background(), branch, defaultBranch)
 	if err != nil {
 		t.Fatalf("LogsOnBranch failed: %v", err)
 	}
@@ -79,6 +81,77 @@ func TestCommitsOnBranch(t *testing.T) {
 	}
 }
 
+func TestCurrentBranch(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := initTestRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := createCommit(dir, "test.txt", "initial content", "Initial commit"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execGit(dir, "checkout", "-b", "test-branch"); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &Repository{Path: dir}
+	current, err := repo.CurrentBranch(context.Background())
+	if err != nil || current != "test-branch" {
+		t.Fatalf("expected current branch test-branch, got %s (%v)", current, err)
+	}
+
+	if _, err = execGit(dir, "checkout", "--detach"); err != nil {
+		t.Fatal(err)
+	}
+	if current, err = repo.CurrentBranch(context.Background()); err != nil || current != "HEAD" {
+		t.Fatalf("expected HEAD when detached, got %s (%v)", current, err)
+	}
+}
+
+func TestGitPath(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := initTestRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &Repository{Path: sub}
+	got, err := repo.GitPath(context.Background(), "hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := filepath.EvalSymlinks(filepath.Join(dir, ".git", "hooks"))
+	if got, _ = filepath.EvalSymlinks(got); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := execGit(dir, "config", "core.hooksPath", "shared-hooks"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = repo.GitPath(context.Background(), "hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(got) || filepath.Base(got) != "shared-hooks" {
+		t.Errorf("core.hooksPath should be followed: %s", got)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	tests := map[string]string{
+		"Update test file\n":                           "Update test file",
+		"    \n    Update test file\n    \n    Body\n": "Update test file",
+		"": "",
+	}
+	for message, want := range tests {
+		if got := (Commit{Message: message}).Subject(); got != want {
+			t.Errorf("%q: got %q, want %q", message, got, want)
+		}
+	}
+}
+
 // Initialize a new git repository in the temporary directory
 func initTestRepo(dir string) (string, error) {
 	_, err := execGit(dir, "init")
@@ -134,3 +207,32 @@ func execGit(dir string, args ...string) (string, error) {
 	}
 	return string(out), nil
 }
+
+func TestHunks(t *testing.T) {
+	diff := FileDiff{
+		Path: "main.go",
+		DiffContents: []string{
+			"new file mode 100644",
+			"@@ -0,0 +1,2 @@",
+			"+package main",
+			"+",
+			"@@ -10,1 +11,1 @@ func main() {",
+			"-\tprintln(1)",
+			"+\tprintln(2)",
+		},
+	}
+
+	header, hunks := diff.Hunks()
+	if len(header) != 1 || header[0] != "new file mode 100644" {
+		t.Fatalf("unexpected header: %v", header)
+	}
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(hunks))
+	}
+	if len(hunks[0]) != 3 || len(hunks[1]) != 3 {
+		t.Fatalf("unexpected hunk sizes: %d, %d", len(hunks[0]), len(hunks[1]))
+	}
+	if hunks[1][0] != "@@ -10,1 +11,1 @@ func main() {" {
+		t.Fatalf("expected the hunk to start with its header, got %q", hunks[1][0])
+	}
+}
@@ -0,0 +1,40 @@
+package git
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchAny reports whether the path matches any of the patterns, in the manner of .gitignore:
+// a pattern without a slash matches the name of the file or of any directory it is in,
+// and a pattern with a slash matches the path from the root of the repository, or any directory of it.
+func MatchAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if match(strings.TrimSuffix(pattern, "/"), p) {
+			return true
+		}
+	}
+	return false
+}
+
+func match(pattern, p string) bool {
+	if pattern == "" {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		for _, name := range strings.Split(p, "/") {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	pattern = strings.TrimPrefix(pattern, "/")
+	for dir := p; dir != "."; dir = path.Dir(dir) {
+		if ok, _ := path.Match(pattern, dir); ok {
+			return true
+		}
+	}
+	return false
+}
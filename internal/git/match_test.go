@@ -0,0 +1,28 @@
+package git
+
+import "testing"
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"go.sum", "go.sum", true},
+		{"go.sum", "tools/go.sum", true},
+		{"*.lock", "web/yarn.lock", true},
+		{"vendor", "vendor/a/b.go", true},
+		{"vendor/", "src/vendor/b.go", true},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/a/b.md", false},
+		{"/api/gen", "api/gen/x.go", true},
+		{"api/gen", "internal/api/gen/x.go", false},
+		{"main.go", "cmd/main.go.orig", false},
+		{"", "main.go", false},
+	}
+	for _, tt := range tests {
+		if got := MatchAny([]string{tt.pattern}, tt.path); got != tt.want {
+			t.Errorf("MatchAny(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CommitsInRange returns the commits reachable from to but not from from, along the first parent,
+// newest first. An empty from gives the whole history of to. Any revision git knows is accepted:
+// branches, tags, hashes or `@{upstream}`.
+// The commits a merge brought in, such as those of a pull request, are set on its Merged field.
+func (r *Repository) CommitsInRange(ctx context.Context, from, to string) ([]Commit, error) {
+	for _, rev := range []string{from, to} {
+		if rev == "" {
+			continue
+		}
+		if _, err := r.ResolveCommit(ctx, rev); err != nil {
+			return nil, err
+		}
+	}
+
+	revs := to
+	if from != "" {
+		revs = from + ".." + to
+	}
+	output, err := r.execGit(ctx, "log", "--first-parent", "-p", "--no-color", revs)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := r.parseLog(output)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range commits {
+		if !commits[i].IsMerge {
+			continue
+		}
+		// The commits of the merged branch which the first parent didn't have yet,
+		// without the merges made on the branch, e.g. to catch up with its base.
+		hash := commits[i].Hash
+		output, err := r.execGit(ctx, "log", "--no-merges", "-p", "--no-color", hash+"^1.."+hash+"^2")
+		if err != nil {
+			return nil, err
+		}
+		if commits[i].Merged, err = r.parseLog(output); err != nil {
+			return nil, err
+		}
+	}
+	return commits, nil
+}
+
+// LatestTag returns the most recent tag reachable from the revision.
+func (r *Repository) LatestTag(ctx context.Context, rev string) (string, error) {
+	out, err := r.execGit(ctx, "describe", "--tags", "--abbrev=0", rev)
+	if err != nil {
+		return "", fmt.Errorf("no tag is reachable from `%s`", rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ResolveCommit returns the hash of the commit the revision points to.
+func (r *Repository) ResolveCommit(ctx context.Context, rev string) (string, error) {
+	out, err := r.execGit(ctx, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("revision `%s` does not exist", rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
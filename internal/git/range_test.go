@@ -0,0 +1,78 @@
+package git
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommitsInRange(t *testing.T) {
+	dir := t.TempDir()
+	main, err := initTestRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := [][]string{
+		{"commit", "a.txt", "a", "Initial commit"},
+		{"git", "tag", "v1.0.0"},
+		{"git", "checkout", "-q", "-b", "feature"},
+		{"commit", "b.txt", "b", "feat: add b"},
+		{"commit", "c.txt", "c", "fix: fix c"},
+		{"git", "checkout", "-q", main},
+		{"commit", "d.txt", "d", "chore: update d"},
+		{"git", "merge", "-q", "--no-ff", "-m", "Merge pull request #1 from feature", "feature"},
+		{"git", "tag", "v1.1.0"},
+	}
+	for _, step := range steps {
+		if step[0] == "commit" {
+			err = createCommit(dir, step[1], step[2], step[3])
+		} else {
+			_, err = execGit(dir, step[1:]...)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := &Repository{Path: dir}
+	ctx := context.Background()
+	commits, err := repo.CommitsInRange(ctx, "v1.0.0", "v1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits on the first parent, got %d", len(commits))
+	}
+	merge := commits[0]
+	if !merge.IsMerge || merge.Subject() != "Merge pull request #1 from feature" {
+		t.Fatalf("expected the merge first, got %q", merge.Subject())
+	}
+	var merged []string
+	for _, c := range merge.Merged {
+		merged = append(merged, c.Subject())
+	}
+	if got := strings.Join(merged, ", "); got != "fix: fix c, feat: add b" {
+		t.Errorf("unexpected merged commits: %s", got)
+	}
+	if len(merge.Merged[0].Diffs) != 1 || merge.Merged[0].Diffs[0].Path != "c.txt" {
+		t.Errorf("the merged commits should have their diffs: %#v", merge.Merged[0].Diffs)
+	}
+	if commits[1].Subject() != "chore: update d" || commits[1].Merged != nil {
+		t.Errorf("unexpected commit %q", commits[1].Subject())
+	}
+
+	all, err := repo.CommitsInRange(ctx, "", "v1.0.0")
+	if err != nil || len(all) != 1 {
+		t.Errorf("expected the whole history of v1.0.0, got %d commits (%v)", len(all), err)
+	}
+	if _, err := repo.CommitsInRange(ctx, "v0.9.0", "HEAD"); err == nil || !strings.Contains(err.Error(), "v0.9.0") {
+		t.Errorf("expected an error for an unknown revision, got %v", err)
+	}
+
+	if tag, err := repo.LatestTag(ctx, "HEAD"); err != nil || tag != "v1.1.0" {
+		t.Errorf("expected v1.1.0, got %s (%v)", tag, err)
+	}
+	if tag, err := repo.LatestTag(ctx, "HEAD^"); err != nil || tag != "v1.0.0" {
+		t.Errorf("expected v1.0.0, got %s (%v)", tag, err)
+	}
+}
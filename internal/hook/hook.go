@@ -0,0 +1,120 @@
+// Package hook installs the prepare-commit-msg git hook which pre-fills commit messages with lgh.
+package hook
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Name is the name of the hook in the hooks directory.
+const Name = "prepare-commit-msg"
+
+// chainedSuffix is appended to the name of the hook which was installed before, which the lgh hook runs first.
+const chainedSuffix = ".pre-lgh"
+
+// marker tells the hooks installed by lgh apart from the others.
+const marker = "# Installed by lgh hook install."
+
+var (
+	ErrNotInstalled = errors.New("the lgh hook is not installed")
+	// ErrForeignHook is returned when the hook in place was not installed by lgh.
+	ErrForeignHook = errors.New("the hook was not installed by lgh")
+)
+
+// Script returns the hook running lgh, the path of the executable, with the timeout for the whole draft.
+// The hook only drafts messages which are written from scratch: not for -m/-F, templates, merges,
+// squashes or amended commits. It never fails the commit: when lgh is missing, the model is
+// unreachable or the draft takes too long, the message is left as git prepared it.
+func Script(lgh string, timeout time.Duration) string {
+	return `#!/bin/sh
+` + marker + `
+# Pre-fills the commit message with a draft made from the staged changes.
+# Remove it with: lgh hook uninstall
+
+chained="$(dirname "$0")/` + Name + chainedSuffix + `"
+if [ -x "$chained" ]; then
+	"$chained" "$@" || exit $?
+fi
+
+# $2 is the source of the message; it is empty when the message is written from scratch.
+[ -z "$2" ] || exit 0
+
+lgh=` + quote(lgh) + `
+[ -x "$lgh" ] || lgh=$(command -v lgh) || exit 0
+draft=$("$lgh" commit-msg --timeout ` + timeout.String() + ` 2>/dev/null) || exit 0
+[ -n "$draft" ] || exit 0
+{ printf '%s\n' "$draft"; cat "$1"; } >"$1.lgh" && mv "$1.lgh" "$1"
+exit 0
+`
+}
+
+// quote quotes s for the shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Install writes the hook script in the hooks directory. A hook which was not installed by lgh
+// is kept under another name and run by the new one first; chained reports whether there was one.
+// Installing again replaces the lgh hook.
+func Install(dir, script string) (chained bool, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	path := filepath.Join(dir, Name)
+	ours, exists, err := installed(path)
+	if err != nil {
+		return false, err
+	}
+	if exists && !ours {
+		if _, err := os.Stat(path + chainedSuffix); err == nil {
+			return false, fmt.Errorf("both %s and %s exist; move one of them away", path, path+chainedSuffix)
+		}
+		if err := os.Rename(path, path+chainedSuffix); err != nil {
+			return false, err
+		}
+		chained = true
+	}
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		return chained, err
+	}
+	// WriteFile keeps the mode of an existing file.
+	return chained, os.Chmod(path, 0755)
+}
+
+// Uninstall removes the lgh hook and puts back the hook it was chained to, if any;
+// restored reports whether there was one.
+func Uninstall(dir string) (restored bool, err error) {
+	path := filepath.Join(dir, Name)
+	ours, exists, err := installed(path)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, ErrNotInstalled
+	}
+	if !ours {
+		return false, fmt.Errorf("%s: %w", path, ErrForeignHook)
+	}
+	if err := os.Remove(path); err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path + chainedSuffix); err != nil {
+		return false, nil
+	}
+	return true, os.Rename(path+chainedSuffix, path)
+}
+
+// installed reports whether the hook at path exists, and whether lgh installed it.
+func installed(path string) (ours, exists bool, err error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	return strings.Contains(string(b), marker), true, nil
+}
@@ -0,0 +1,129 @@
+package hook
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstallUninstall(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hooks")
+	path := filepath.Join(dir, Name)
+
+	if _, err := Uninstall(dir); !errors.Is(err, ErrNotInstalled) {
+		t.Fatalf("expected ErrNotInstalled, got %v", err)
+	}
+
+	chained, err := Install(dir, Script("/usr/bin/lgh", time.Minute))
+	if err != nil || chained {
+		t.Fatalf("unexpected result: %v, %v", chained, err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm()&0100 == 0 {
+		t.Fatalf("the hook should be executable: %v", err)
+	}
+	// Installing again replaces the lgh hook without chaining it to itself.
+	if chained, err = Install(dir, Script("/usr/local/bin/lgh", time.Minute)); err != nil || chained {
+		t.Fatalf("unexpected result: %v, %v", chained, err)
+	}
+	if restored, err := Uninstall(dir); err != nil || restored {
+		t.Fatalf("unexpected result: %v, %v", restored, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("the hook should be removed")
+	}
+
+	// A hook of another tool is chained, and put back on uninstall.
+	foreign := "#!/bin/sh\necho foreign\n"
+	if err := os.WriteFile(path, []byte(foreign), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Uninstall(dir); !errors.Is(err, ErrForeignHook) {
+		t.Fatalf("expected ErrForeignHook, got %v", err)
+	}
+	if chained, err = Install(dir, Script("lgh", time.Minute)); err != nil || !chained {
+		t.Fatalf("unexpected result: %v, %v", chained, err)
+	}
+	if b, _ := os.ReadFile(path + chainedSuffix); string(b) != foreign {
+		t.Fatalf("the foreign hook should be kept: %q", b)
+	}
+	if restored, err := Uninstall(dir); err != nil || !restored {
+		t.Fatalf("unexpected result: %v, %v", restored, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != foreign {
+		t.Fatalf("the foreign hook should be restored: %q", b)
+	}
+}
+
+func TestScript(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_EDITOR=true")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	git("init", "-q")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "Test User")
+
+	// A fake lgh, which answers like the model or fails like an unreachable one.
+	lgh := filepath.Join(t.TempDir(), "it's lgh")
+	write := func(script string) {
+		t.Helper()
+		if err := os.WriteFile(lgh, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("#!/bin/sh\nprintf 'feat: add a\\n\\n* details\\n'\n")
+
+	hooks := filepath.Join(dir, ".git", "hooks")
+	chainedLog := filepath.Join(dir, "chained.log")
+	if err := os.WriteFile(filepath.Join(hooks, Name), []byte("#!/bin/sh\necho \"$2\" >>"+quote(chainedLog)+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Install(hooks, Script(lgh, time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(file string, args ...string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", file)
+		git(append([]string{"commit", "-q"}, args...)...)
+		return strings.TrimSpace(git("log", "-1", "--format=%B"))
+	}
+
+	if msg := commit("a"); msg != "feat: add a\n\n* details" {
+		t.Errorf("the message should be drafted: %q", msg)
+	}
+	if msg := commit("b", "-m", "Add b"); msg != "Add b" {
+		t.Errorf("a given message should be kept: %q", msg)
+	}
+	if msg := commit("c", "--amend", "--no-edit"); msg != "Add b" {
+		t.Errorf("an amended message should be kept: %q", msg)
+	}
+
+	// The commit goes through, with an empty message allowed, when lgh fails.
+	write("#!/bin/sh\necho unreachable >&2\nexit 1\n")
+	if msg := commit("d", "--allow-empty-message"); msg != "" {
+		t.Errorf("no draft is expected: %q", msg)
+	}
+
+	if b, _ := os.ReadFile(chainedLog); string(b) != "\nmessage\ncommit\n\n" {
+		t.Errorf("the chained hook should run on every commit: %q", b)
+	}
+}
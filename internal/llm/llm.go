@@ -0,0 +1,38 @@
+// Package llm defines the provider-neutral interface lgh uses to talk to chat models.
+package llm
+
+import "context"
+
+// DefaultTemperature is the sampling temperature used when none is configured.
+const DefaultTemperature = 0.7
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string
+	Content string
+}
+
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+type Response struct {
+	Content string
+	Usage   Usage
+}
+
+// Client is implemented by every chat model backend.
+// Cancelling the context aborts the request, including any retries.
+type Client interface {
+	Chat(ctx context.Context, messages []*Message) (*Response, error)
+}
@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter keeps the requests and tokens sent per minute under the given limits,
+// so that parallel requests don't just run into 429 responses.
+// It is a token bucket for each limit which refills continuously; a zero limit disables it.
+// A RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+
+	mu       sync.Mutex
+	requests float64
+	tokens   float64
+	last     time.Time
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+// Wait blocks until a request of the estimated number of tokens may be sent, and reserves it.
+// It returns the context's error if the context is done first.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	for {
+		d := l.reserve(tokens)
+		if d <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// Adjust corrects the reserved tokens once the actual usage of a request is known.
+func (l *RateLimiter) Adjust(estimated, actual int) {
+	if l.TokensPerMinute <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens += float64(estimated - actual)
+	if limit := float64(l.TokensPerMinute); l.tokens > limit {
+		l.tokens = limit
+	}
+}
+
+// reserve takes the budget for a request if available, otherwise it returns how long to wait.
+func (l *RateLimiter) reserve(tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t := now()
+	if l.last.IsZero() {
+		l.requests = float64(l.RequestsPerMinute)
+		l.tokens = float64(l.TokensPerMinute)
+	} else {
+		elapsed := t.Sub(l.last).Minutes()
+		l.requests = refill(l.requests, elapsed, l.RequestsPerMinute)
+		l.tokens = refill(l.tokens, elapsed, l.TokensPerMinute)
+	}
+	l.last = t
+
+	// A request larger than the whole budget is sent once the bucket is full.
+	need := float64(min(tokens, l.TokensPerMinute))
+
+	var wait time.Duration
+	if l.RequestsPerMinute > 0 && l.requests < 1 {
+		wait = max(wait, untilFilled(1-l.requests, l.RequestsPerMinute))
+	}
+	if l.TokensPerMinute > 0 && l.tokens < need {
+		wait = max(wait, untilFilled(need-l.tokens, l.TokensPerMinute))
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if l.RequestsPerMinute > 0 {
+		l.requests--
+	}
+	if l.TokensPerMinute > 0 {
+		l.tokens -= float64(tokens)
+	}
+	return 0
+}
+
+func refill(current, minutes float64, limit int) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	current += minutes * float64(limit)
+	if current > float64(limit) {
+		return float64(limit)
+	}
+	return current
+}
+
+func untilFilled(missing float64, limit int) time.Duration {
+	return time.Duration(missing / float64(limit) * float64(time.Minute))
+}
@@ -0,0 +1,35 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	l := &RateLimiter{RequestsPerMinute: 2, TokensPerMinute: 1000}
+	if d := l.reserve(400); d != 0 {
+		t.Fatalf("expected the first request to pass, got wait %v", d)
+	}
+	if d := l.reserve(400); d != 0 {
+		t.Fatalf("expected the second request to pass, got wait %v", d)
+	}
+	// Out of requests: one request refills in 30s.
+	if d := l.reserve(100); d != 30*time.Second {
+		t.Fatalf("expected to wait 30s for the request budget, got %v", d)
+	}
+
+	clock = clock.Add(30 * time.Second)
+	// 200 + 500 refilled tokens are available, 900 are needed.
+	if d := l.reserve(900); d != 12*time.Second {
+		t.Fatalf("expected to wait 12s for the token budget, got %v", d)
+	}
+
+	l.Adjust(400, 100)
+	if d := l.reserve(900); d != 0 {
+		t.Fatalf("expected adjusted tokens to be available, got wait %v", d)
+	}
+}
@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is returned when the provider answers with a non-200 status.
+// Type, Code and Message are taken from the error body when the provider sends one,
+// so that e.g. an exhausted quota can be told apart from an unknown model.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Code       string
+	Message    string
+	// RetryAfter is how long the provider asked us to wait, if it said so.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	var details []string
+	if e.Type != "" {
+		details = append(details, "type: "+e.Type)
+	}
+	if e.Code != "" {
+		details = append(details, "code: "+e.Code)
+	}
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, ", ") + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Retryable reports whether sending the same request again may succeed.
+func (e *APIError) Retryable() bool {
+	// A 429 caused by an exhausted quota or billing problem will not resolve by waiting.
+	if e.Code == "insufficient_quota" || e.Type == "insufficient_quota" {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// RetryPolicy controls how transient failures are retried.
+// The delay between attempts grows exponentially with full jitter, unless the provider
+// tells us how long to wait via the Retry-After or rate limit headers.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 5,
+	BaseDelay:  time.Second,
+	MaxDelay:   time.Minute,
+}
+
+// maxRetryAfter caps the wait requested by the provider, so a bogus header can't stall a run forever.
+const maxRetryAfter = 5 * time.Minute
+
+// sleep waits for d or until the context is done. It is replaced in tests.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do sends the request created by newReq and retries it on network errors and retryable API errors.
+// newReq is called for every attempt because a request body can only be read once;
+// it must create the request with the given context.
+// parseError converts a non-200 response into an APIError; its body is closed by Do.
+// Waiting between attempts stops as soon as the context is done.
+func (p RetryPolicy) Do(
+	ctx context.Context,
+	client *http.Client,
+	newReq func(ctx context.Context) (*http.Request, error),
+	parseError func(res *http.Response) *APIError,
+) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newReq(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= p.MaxRetries || !isTemporary(err) {
+				return nil, err
+			}
+			if err = sleep(ctx, p.backoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if res.StatusCode == http.StatusOK {
+			return res, nil
+		}
+
+		apiErr := parseError(res)
+		res.Body.Close()
+		apiErr.StatusCode = res.StatusCode
+		apiErr.RetryAfter = RetryAfter(res.Header)
+		if attempt >= p.MaxRetries || !apiErr.Retryable() {
+			return nil, apiErr
+		}
+
+		wait := p.backoff(attempt)
+		if apiErr.RetryAfter > 0 {
+			wait = min(apiErr.RetryAfter, maxRetryAfter) + jitter(p.BaseDelay)
+		}
+		if err = sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	return jitter(d)
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+func isTemporary(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var oe *net.OpError
+	if errors.As(err, &oe) {
+		// A refused connection usually means a wrong URL or a server that is not running.
+		return oe.Op != "dial"
+	}
+	// The connection was dropped by the server or a proxy.
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "EOF")
+}
+
+// RetryAfter returns the wait requested by the response headers, or 0 if there is none.
+// It understands the standard Retry-After header (seconds or HTTP date), retry-after-ms,
+// OpenAI's x-ratelimit-reset-* durations and Anthropic's anthropic-ratelimit-*-reset timestamps.
+func RetryAfter(h http.Header) time.Duration {
+	if v := h.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if s, err := strconv.ParseFloat(v, 64); err == nil && s > 0 {
+			return time.Duration(s * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+		}
+	}
+
+	// Only the limits that are actually exhausted matter.
+	var wait time.Duration
+	for _, kind := range []string{"requests", "tokens"} {
+		if h.Get("x-ratelimit-remaining-"+kind) == "0" {
+			if d, err := time.ParseDuration(h.Get("x-ratelimit-reset-" + kind)); err == nil && d > wait {
+				wait = d
+			}
+		}
+		if h.Get("anthropic-ratelimit-"+kind+"-remaining") == "0" {
+			if t, err := time.Parse(time.RFC3339, h.Get("anthropic-ratelimit-"+kind+"-reset")); err == nil {
+				if d := time.Until(t); d > wait {
+					wait = d
+				}
+			}
+		}
+	}
+	return wait
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+	}{
+		{"none", map[string]string{}, 0},
+		{"seconds", map[string]string{"Retry-After": "3"}, 3 * time.Second},
+		{"milliseconds", map[string]string{"retry-after-ms": "250"}, 250 * time.Millisecond},
+		{
+			"openai reset",
+			map[string]string{
+				"x-ratelimit-remaining-requests": "10",
+				"x-ratelimit-reset-requests":     "1s",
+				"x-ratelimit-remaining-tokens":   "0",
+				"x-ratelimit-reset-tokens":       "6m0s",
+			},
+			6 * time.Minute,
+		},
+		{
+			"openai not exhausted",
+			map[string]string{"x-ratelimit-remaining-tokens": "100", "x-ratelimit-reset-tokens": "20ms"},
+			0,
+		},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.headers {
+			h.Set(k, v)
+		}
+		if got := RetryAfter(h); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	var waits []time.Duration
+	orig := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	defer func() { sleep = orig }()
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer srv.Close()
+
+	p := RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+	res, err := p.Do(context.Background(), srv.Client(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	}, func(res *http.Response) *APIError { return &APIError{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+	if len(waits) != 2 || waits[0] < 2*time.Second {
+		t.Fatalf("expected to honor Retry-After, got waits %v", waits)
+	}
+}
+
+func TestRetryPolicyDoNotRetryable(t *testing.T) {
+	orig := sleep
+	sleep = func(context.Context, time.Duration) error { return nil }
+	defer func() { sleep = orig }()
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := DefaultRetryPolicy.Do(context.Background(), srv.Client(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	}, func(res *http.Response) *APIError {
+		return &APIError{Type: "insufficient_quota", Code: "insufficient_quota", Message: "quota exceeded"}
+	})
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+	want := "unexpected status code: 429 (type: insufficient_quota, code: insufficient_quota): quota exceeded"
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func TestRetryPolicyDoCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := DefaultRetryPolicy.Do(ctx, srv.Client(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	}, func(res *http.Response) *APIError { return &APIError{} })
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("expected the wait to stop with the context")
+	}
+}
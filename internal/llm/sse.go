@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+)
+
+// Streamer is implemented by clients that can stream the answer while it is generated.
+// onDelta is called with every piece of text as it arrives; the returned Response holds
+// the whole answer and the usage, like Chat.
+type Streamer interface {
+	ChatStream(ctx context.Context, messages []*Message, onDelta func(string)) (*Response, error)
+}
+
+// ReadSSE reads a server-sent events stream and calls fn with the name and the data of every event.
+// The event name is empty when the server sends only data lines.
+func ReadSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	var (
+		event string
+		data  []string
+	)
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment, used as a keep-alive
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return dispatch()
+}
@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadSSE(t *testing.T) {
+	stream := ": keep-alive\n" +
+		"event: message_start\n" +
+		"data: {\"a\":1}\n" +
+		"\n" +
+		"data: first\n" +
+		"data: second\n" +
+		"\n" +
+		"data: [DONE]"
+
+	var events, datas []string
+	err := ReadSSE(strings.NewReader(stream), func(event, data string) error {
+		events = append(events, event)
+		datas = append(datas, data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantEvents := []string{"message_start", "", ""}
+	wantDatas := []string{`{"a":1}`, "first\nsecond", "[DONE]"}
+	if strings.Join(events, ",") != strings.Join(wantEvents, ",") {
+		t.Fatalf("expected events %q, got %q", wantEvents, events)
+	}
+	if strings.Join(datas, "|") != strings.Join(wantDatas, "|") {
+		t.Fatalf("expected data %q, got %q", wantDatas, datas)
+	}
+}
@@ -0,0 +1,18 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Schema is a JSON Schema the answer must follow, with a name some providers require.
+type Schema struct {
+	Name   string
+	Schema json.RawMessage
+}
+
+// StructuredClient is implemented by clients whose provider can constrain the answer to a JSON schema.
+// The content of the returned Response is the JSON document.
+type StructuredClient interface {
+	ChatJSON(ctx context.Context, messages []*Message, schema *Schema) (*Response, error)
+}
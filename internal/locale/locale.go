@@ -0,0 +1,123 @@
+// Package locale is the registry of output languages: BCP-47 tags, the names the prompts use,
+// and hints on the writing conventions of each language.
+package locale
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Locale struct {
+	// Tag is the BCP-47 language tag, e.g. "pt-BR".
+	Tag string
+	// Name is the name of the language in English, as the prompts refer to it.
+	Name string
+	// Hint tells the model the conventions of the language which it tends to get wrong,
+	// e.g. the format of dates or the style of headings. It may be empty.
+	Hint string
+}
+
+// Default is the locale used when none is configured.
+const Default = "en"
+
+var locales = []*Locale{
+	{"ar", "Arabic", "Use Modern Standard Arabic. Keep code identifiers in Latin script."},
+	{"de", "German", "Use the formal register. Write dates as DD.MM.YYYY. Capitalize only the first word and nouns in headings."},
+	{"en", "English", "Write dates as YYYY-MM-DD. Use sentence case in headings."},
+	{"en-GB", "British English", "Use British spelling. Write dates as DD/MM/YYYY. Use sentence case in headings."},
+	{"es", "Spanish", "Write dates as DD/MM/YYYY. Capitalize only the first word in headings."},
+	{"fr", "French", "Write dates as DD/MM/YYYY. Put a non-breaking space before : ; ! and ?. Capitalize only the first word in headings."},
+	{"hi", "Hindi", "Use Devanagari script. Keep code identifiers in Latin script."},
+	{"id", "Indonesian", "Write dates as DD/MM/YYYY."},
+	{"it", "Italian", "Write dates as DD/MM/YYYY. Capitalize only the first word in headings."},
+	{"ja", "Japanese", "Use the plain form (である調) in bullet points. Write dates as YYYY年M月D日."},
+	{"ko", "Korean", "End bullet points with a noun form (e.g. 추가, 수정) rather than a full sentence. Write dates as YYYY. M. D."},
+	{"nl", "Dutch", "Write dates as DD-MM-YYYY. Capitalize only the first word in headings."},
+	{"pl", "Polish", "Write dates as DD.MM.YYYY. Capitalize only the first word in headings."},
+	{"pt", "European Portuguese", "Use European Portuguese spelling. Write dates as DD/MM/YYYY."},
+	{"pt-BR", "Brazilian Portuguese", "Use Brazilian Portuguese spelling and vocabulary. Write dates as DD/MM/YYYY."},
+	{"ru", "Russian", "Write dates as DD.MM.YYYY. Capitalize only the first word in headings."},
+	{"sv", "Swedish", "Write dates as YYYY-MM-DD. Capitalize only the first word in headings."},
+	{"th", "Thai", "Keep code identifiers in Latin script."},
+	{"tr", "Turkish", "Write dates as DD.MM.YYYY."},
+	{"uk", "Ukrainian", "Write dates as DD.MM.YYYY. Capitalize only the first word in headings."},
+	{"vi", "Vietnamese", "Write dates as DD/MM/YYYY."},
+	{"zh-Hans", "Simplified Chinese", "Use simplified characters and full-width punctuation. Write dates as YYYY年M月D日."},
+	{"zh-Hant", "Traditional Chinese", "Use traditional characters and full-width punctuation. Write dates as YYYY年M月D日."},
+}
+
+// aliases map common tags to the registered ones.
+var aliases = map[string]string{
+	"zh":    "zh-Hans",
+	"zh-cn": "zh-Hans",
+	"zh-sg": "zh-Hans",
+	"zh-tw": "zh-Hant",
+	"zh-hk": "zh-Hant",
+	"zh-mo": "zh-Hant",
+	"pt-pt": "pt",
+	"en-us": "en",
+	"en-uk": "en-GB",
+}
+
+// Lookup finds the locale of a BCP-47 tag. Tags are case-insensitive and may use underscores,
+// as in POSIX locales (pt_BR.UTF-8). When the tag itself is unknown, its subtags are removed
+// from the end until a registered tag is found (RFC 4647 lookup), so "de-AT" gives German.
+// The POSIX locales without a language, C and POSIX, give the default locale.
+func Lookup(tag string) (*Locale, error) {
+	t := strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	t, _, _ = strings.Cut(t, ".")
+	if t == "c" || t == "posix" {
+		t = strings.ToLower(Default)
+	}
+	for t != "" {
+		if alias, ok := aliases[t]; ok {
+			t = strings.ToLower(alias)
+		}
+		for _, l := range locales {
+			if strings.ToLower(l.Tag) == t {
+				return l, nil
+			}
+		}
+		i := strings.LastIndex(t, "-")
+		if i < 0 {
+			break
+		}
+		t = t[:i]
+	}
+	return nil, fmt.Errorf("unknown language: %s (available: %s)", tag, strings.Join(Tags(), ", "))
+}
+
+// Tags returns the registered tags, sorted.
+func Tags() []string {
+	tags := make([]string, len(locales))
+	for i, l := range locales {
+		tags[i] = l.Tag
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// ParseList finds the locales of a comma-separated list of tags, e.g. "en,ja".
+// Tags of the same locale are given once, in the order of their first appearance.
+func ParseList(tags string) ([]*Locale, error) {
+	var ret []*Locale
+	seen := map[*Locale]bool{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag == "" {
+			continue
+		}
+		l, err := Lookup(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[l] {
+			seen[l] = true
+			ret = append(ret, l)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no language is given")
+	}
+	return ret, nil
+}
@@ -0,0 +1,74 @@
+package locale
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := map[string]string{
+		"en":          "en",
+		"ja":          "ja",
+		"pt-BR":       "pt-BR",
+		"pt_br":       "pt-BR",
+		"pt_BR.UTF-8": "pt-BR",
+		"pt-PT":       "pt",
+		"de-AT":       "de",
+		"zh-TW":       "zh-Hant",
+		"zh-Hant-HK":  "zh-Hant",
+		"zh":          "zh-Hans",
+		"ko-KR":       "ko",
+		"C":           "en",
+		"C.UTF-8":     "en",
+		"POSIX":       "en",
+	}
+	for tag, want := range tests {
+		l, err := Lookup(tag)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tag, err)
+			continue
+		}
+		if l.Tag != want {
+			t.Errorf("%s: got %s, want %s", tag, l.Tag, want)
+		}
+	}
+
+	for _, tag := range []string{"", "xx", "klingon", "-"} {
+		if _, err := Lookup(tag); err == nil {
+			t.Errorf("%q: expected an error", tag)
+		}
+	}
+}
+
+func TestLookupPOSIXLocale(t *testing.T) {
+	// Containers and CI runners often have no language in $LANG.
+	t.Setenv("LANG", "C.UTF-8")
+	l, err := Lookup(os.Getenv("LANG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Tag != Default {
+		t.Errorf("got %s, want %s", l.Tag, Default)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	locales, err := ParseList(" en, ja ,en-US,,pt_BR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags []string
+	for _, l := range locales {
+		tags = append(tags, l.Tag)
+	}
+	if got := strings.Join(tags, ","); got != "en,ja,pt-BR" {
+		t.Errorf("got %s", got)
+	}
+
+	for _, tags := range []string{"", " , ", "en,xx"} {
+		if _, err := ParseList(tags); err == nil {
+			t.Errorf("%q: expected an error", tags)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tetran/lgh/internal/llm"
+)
+
+const (
+	DefaultBaseURL = "http://localhost:11434"
+	// Local models can be slow, especially on the first request that loads the model.
+	DefaultTimeout = 5 * time.Minute
+)
+
+type ChatRequest struct {
+	Model    string     `json:"model"`
+	Messages []*Message `json:"messages"`
+	Stream   bool       `json:"stream"`
+	// Format is "json" or a JSON schema the answer must follow.
+	Format  json.RawMessage `json:"format,omitempty"`
+	Options *Options        `json:"options,omitempty"`
+}
+
+type Options struct {
+	Temperature float64 `json:"temperature"`
+}
+
+type ChatResponse struct {
+	Message         *Message `json:"message"`
+	Done            bool     `json:"done"`
+	PromptEvalCount int      `json:"prompt_eval_count"`
+	EvalCount       int      `json:"eval_count"`
+	// Error is set when a streamed response fails midway.
+	Error string `json:"error,omitempty"`
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Client talks to the native chat endpoint of an Ollama server. No API key is needed.
+type Client struct {
+	BaseURL string
+	Model   string
+	// Timeout limits each attempt of a request. Zero uses DefaultTimeout.
+	Timeout time.Duration
+	// Retry overrides llm.DefaultRetryPolicy when set.
+	Retry *llm.RetryPolicy
+	// Temperature overrides llm.DefaultTemperature when set.
+	Temperature *float64
+	Debug       bool
+}
+
+func (c *Client) Chat(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+	return c.chat(ctx, c.newRequest(messages, false))
+}
+
+// ChatJSON implements llm.StructuredClient with the format parameter.
+func (c *Client) ChatJSON(ctx context.Context, messages []*llm.Message, schema *llm.Schema) (*llm.Response, error) {
+	creq := c.newRequest(messages, false)
+	creq.Format = schema.Schema
+	return c.chat(ctx, creq)
+}
+
+func (c *Client) chat(ctx context.Context, creq *ChatRequest) (*llm.Response, error) {
+	res, err := c.send(ctx, creq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	cres := &ChatResponse{}
+	err = json.NewDecoder(res.Body).Decode(&cres)
+	if err != nil {
+		return nil, err
+	}
+	if cres.Message == nil {
+		return nil, fmt.Errorf("no message in response")
+	}
+
+	if c.Debug {
+		cres.print()
+	}
+
+	return cres.toResponse(), nil
+}
+
+// ChatStream implements llm.Streamer. Ollama streams one JSON object per line;
+// the last one has done set and carries the token counts.
+func (c *Client) ChatStream(ctx context.Context, messages []*llm.Message, onDelta func(string)) (*llm.Response, error) {
+	res, err := c.send(ctx, c.newRequest(messages, true))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var content strings.Builder
+	cres := &ChatResponse{}
+	dec := json.NewDecoder(res.Body)
+	for {
+		chunk := &ChatResponse{}
+		if err = dec.Decode(chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if chunk.Error != "" {
+			return nil, &llm.APIError{StatusCode: http.StatusOK, Message: chunk.Error}
+		}
+		if chunk.Message != nil && chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			cres = chunk
+			break
+		}
+	}
+	cres.Message = &Message{Role: llm.RoleAssistant, Content: content.String()}
+
+	if c.Debug {
+		cres.print()
+	}
+
+	return cres.toResponse(), nil
+}
+
+func (c *Client) newRequest(messages []*llm.Message, stream bool) *ChatRequest {
+	creq := &ChatRequest{
+		Model:    c.Model,
+		Messages: make([]*Message, 0, len(messages)),
+		Stream:   stream,
+		Options:  &Options{Temperature: c.temperature()},
+	}
+	for _, m := range messages {
+		creq.Messages = append(creq.Messages, &Message{Role: m.Role, Content: m.Content})
+	}
+	return creq
+}
+
+func (c *Client) send(ctx context.Context, creq *ChatRequest) (*http.Response, error) {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	url := strings.TrimSuffix(base, "/") + "/api/chat"
+	if c.Debug {
+		creq.print()
+	}
+	body, err := json.Marshal(creq)
+	if err != nil {
+		return nil, err
+	}
+
+	// The timeout applies to each attempt, including reading a streamed answer.
+	client := &http.Client{
+		Timeout: c.timeout(),
+	}
+	return c.retryPolicy().Do(ctx, client, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodPost,
+			url,
+			bytes.NewReader(body),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, parseError)
+}
+
+func (r *ChatResponse) toResponse() *llm.Response {
+	return &llm.Response{
+		Content: r.Message.Content,
+		Usage: llm.Usage{
+			PromptTokens:     r.PromptEvalCount,
+			CompletionTokens: r.EvalCount,
+		},
+	}
+}
+
+func (r *ChatRequest) print() {
+	fmt.Fprintf(os.Stderr, "\n## Chat Request\n")
+	fmt.Fprintln(os.Stderr, "### Model")
+	fmt.Fprintln(os.Stderr, r.Model)
+	fmt.Fprintln(os.Stderr, "### Prompts")
+	for _, m := range r.Messages {
+		fmt.Fprintf(os.Stderr, "- %s \n%s\n", m.Role, m.Content)
+	}
+}
+
+func (r *ChatResponse) print() {
+	fmt.Fprintf(os.Stderr, "\n## Chat Response\n")
+	fmt.Fprintf(os.Stderr, "### Message\n%s\n", r.Message.Content)
+	fmt.Fprintf(os.Stderr,
+		"\n### Usages\ntotal: %d (prompt: %d, completion: %d)\n",
+		r.PromptEvalCount+r.EvalCount,
+		r.PromptEvalCount,
+		r.EvalCount)
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (c *Client) temperature() float64 {
+	if c.Temperature != nil {
+		return *c.Temperature
+	}
+	return llm.DefaultTemperature
+}
+
+func (c *Client) retryPolicy() llm.RetryPolicy {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	return llm.DefaultRetryPolicy
+}
+
+// parseError reads the `{"error": "..."}` body returned by Ollama.
+func parseError(res *http.Response) *llm.APIError {
+	apiErr := &llm.APIError{}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return apiErr
+	}
+	apiErr.Message = body.Error
+	return apiErr
+}
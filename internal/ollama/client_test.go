@@ -0,0 +1,108 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tetran/lgh/internal/llm"
+)
+
+var noRetry = &llm.RetryPolicy{}
+
+func TestChat(t *testing.T) {
+	var got ChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "summary"}, "done": true, "prompt_eval_count": 10, "eval_count": 5}`))
+	}))
+	defer srv.Close()
+
+	temperature := 0.2
+	// The base URL may end with a slash.
+	c := &Client{BaseURL: srv.URL + "/", Model: "llama3", Temperature: &temperature, Retry: noRetry}
+	res, err := c.Chat(context.Background(), []*llm.Message{
+		{Role: llm.RoleSystem, Content: "persona"},
+		{Role: llm.RoleUser, Content: "diff"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "summary" || res.Usage.PromptTokens != 10 || res.Usage.CompletionTokens != 5 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if got.Model != "llama3" || got.Stream || got.Options == nil || got.Options.Temperature != 0.2 || got.Format != nil {
+		t.Errorf("unexpected request %+v", got)
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Role != llm.RoleSystem || got.Messages[1].Content != "diff" {
+		t.Errorf("unexpected messages %+v", got.Messages)
+	}
+
+	schema := json.RawMessage(`{"type":"object"}`)
+	if _, err = c.ChatJSON(context.Background(), []*llm.Message{{Role: llm.RoleUser, Content: "diff"}}, &llm.Schema{Name: "s", Schema: schema}); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Format) != string(schema) {
+		t.Errorf("expected the schema as the format, got %s", got.Format)
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "sum"}, "done": false}
+{"message": {"role": "assistant", "content": "mary"}, "done": false}
+{"message": {"role": "assistant", "content": ""}, "done": true, "prompt_eval_count": 10, "eval_count": 2}
+`))
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL, Model: "llama3", Retry: noRetry}
+	var deltas []string
+	res, err := c.ChatStream(context.Background(), []*llm.Message{{Role: llm.RoleUser, Content: "diff"}}, func(s string) {
+		deltas = append(deltas, s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "summary" || strings.Join(deltas, "|") != "sum|mary" || res.Usage.Total() != 12 {
+		t.Errorf("unexpected response %+v, deltas %q", res, deltas)
+	}
+}
+
+func TestChatError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"model not pulled", http.StatusNotFound, `{"error": "model \"llama9\" not found, try pulling it first"}`, `model "llama9" not found`},
+		{"not JSON", http.StatusInternalServerError, `oops`, ""},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+
+		c := &Client{BaseURL: srv.URL, Model: "llama9", Retry: noRetry}
+		_, err := c.Chat(context.Background(), []*llm.Message{{Role: llm.RoleUser, Content: "diff"}})
+		var apiErr *llm.APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: expected an API error, got %v", tt.name, err)
+		} else if apiErr.StatusCode != tt.status || !strings.Contains(apiErr.Message, tt.want) {
+			t.Errorf("%s: unexpected error %+v", tt.name, apiErr)
+		}
+		srv.Close()
+	}
+}
@@ -4,15 +4,41 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
+
+	"github.com/tetran/lgh/internal/llm"
 )
 
 type ChatRequest struct {
-	Model       string     `json:"model"`
-	Messages    []*Message `json:"messages"`
-	Temperature float64    `json:"temperature"`
+	Model         string         `json:"model"`
+	Messages      []*Message     `json:"messages"`
+	Temperature   float64        `json:"temperature"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	// ResponseFormat asks for a JSON answer.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type ResponseFormat struct {
+	// Type is "json_schema", or "json_object" for models without structured outputs.
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+type JSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type ChatResponse struct {
@@ -22,6 +48,8 @@ type ChatResponse struct {
 
 type Choice struct {
 	Message *Message `json:"message"`
+	// Delta is set instead of Message in streamed chunks.
+	Delta *Message `json:"delta,omitempty"`
 }
 
 type Message struct {
@@ -35,80 +63,271 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+const (
+	DefaultBaseURL         = "https://api.openai.com/v1"
+	DefaultAzureAPIVersion = "2024-06-01"
+	DefaultTimeout         = 60 * time.Second
+)
+
+// Client talks to the OpenAI chat completions API, or to any server compatible with it
+// when BaseURL is set (e.g. a local model server). ApiKey may be empty for such servers.
+//
+// When Deployment is set, the client targets an Azure OpenAI deployment instead.
+// BaseURL must then be the resource endpoint (https://<resource>.openai.azure.com).
 type Client struct {
-	ApiKey string
-	Model  string
-	Debug  bool
+	ApiKey     string
+	Model      string
+	BaseURL    string
+	Deployment string
+	APIVersion string
+	// Timeout limits each attempt of a request. Zero uses DefaultTimeout.
+	Timeout time.Duration
+	// Retry overrides llm.DefaultRetryPolicy when set.
+	Retry *llm.RetryPolicy
+	// Temperature overrides llm.DefaultTemperature when set.
+	Temperature *float64
+	Debug       bool
 }
 
-func (c *Client) Chat(messages []*Message) (*ChatResponse, error) {
-	url := "https://api.openai.com/v1/chat/completions"
-	creq := &ChatRequest{
-		Model:       c.Model,
-		Messages:    messages,
-		Temperature: 0.7,
+func (c *Client) isAzure() bool {
+	return c.Deployment != ""
+}
+
+func (c *Client) endpoint() string {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
 	}
-	if c.Debug {
-		creq.print()
+	base = strings.TrimSuffix(base, "/")
+	if !c.isAzure() {
+		return base + "/chat/completions"
 	}
-	body, err := json.Marshal(creq)
+
+	version := c.APIVersion
+	if version == "" {
+		version = DefaultAzureAPIVersion
+	}
+	return fmt.Sprintf(
+		"%s/openai/deployments/%s/chat/completions?api-version=%s",
+		base, url.PathEscape(c.Deployment), url.QueryEscape(version))
+}
+
+func (c *Client) setAuth(req *http.Request) {
+	if c.ApiKey == "" {
+		return
+	}
+	if c.isAzure() {
+		req.Header.Set("api-key", c.ApiKey)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.ApiKey)
+	}
+}
+
+func (c *Client) Chat(ctx context.Context, messages []*llm.Message) (*llm.Response, error) {
+	return c.chat(ctx, c.newRequest(messages))
+}
+
+// ChatJSON implements llm.StructuredClient with structured outputs. Models and servers which
+// don't support JSON schemas are asked for a JSON object instead, with the schema left to the prompt.
+func (c *Client) ChatJSON(ctx context.Context, messages []*llm.Message, schema *llm.Schema) (*llm.Response, error) {
+	creq := c.newRequest(messages)
+	creq.ResponseFormat = &ResponseFormat{
+		Type:       "json_schema",
+		JSONSchema: &JSONSchema{Name: schema.Name, Schema: schema.Schema, Strict: true},
+	}
+	res, err := c.chat(ctx, creq)
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest &&
+		strings.Contains(apiErr.Message, "response_format") {
+		creq.ResponseFormat = &ResponseFormat{Type: "json_object"}
+		return c.chat(ctx, creq)
+	}
+	return res, err
+}
+
+func (c *Client) chat(ctx context.Context, creq *ChatRequest) (*llm.Response, error) {
+	res, err := c.send(ctx, creq)
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
-	req, err := http.NewRequestWithContext(
-		context.Background(),
-		http.MethodPost,
-		url,
-		bytes.NewBuffer(body),
-	)
+	cres := &ChatResponse{}
+	err = json.NewDecoder(res.Body).Decode(&cres)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.ApiKey)
 
-	client := http.Client{
-		Timeout: 60 * time.Second,
+	if len(cres.Choices) == 0 || cres.Choices[0].Message == nil {
+		return nil, fmt.Errorf("no choices in response")
 	}
-	res, err := client.Do(req)
+
+	if c.Debug {
+		cres.print()
+	}
+
+	return cres.toResponse(), nil
+}
+
+// ChatStream implements llm.Streamer using server-sent events.
+func (c *Client) ChatStream(ctx context.Context, messages []*llm.Message, onDelta func(string)) (*llm.Response, error) {
+	creq := c.newRequest(messages)
+	creq.Stream = true
+	creq.StreamOptions = &StreamOptions{IncludeUsage: true}
+	res, err := c.send(ctx, creq)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
-	}
 
+	var content strings.Builder
 	cres := &ChatResponse{}
-	err = json.NewDecoder(res.Body).Decode(&cres)
+	err = llm.ReadSSE(res.Body, func(_, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		chunk := &ChatResponse{}
+		if err := json.Unmarshal([]byte(data), chunk); err != nil {
+			return err
+		}
+		for _, ch := range chunk.Choices {
+			if ch.Delta != nil && ch.Delta.Content != "" {
+				content.WriteString(ch.Delta.Content)
+				onDelta(ch.Delta.Content)
+			}
+		}
+		// With include_usage, the last chunk carries the usage of the whole request.
+		if chunk.Usage != nil {
+			cres.Usage = chunk.Usage
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	cres.Choices = []*Choice{{Message: &Message{Role: llm.RoleAssistant, Content: content.String()}}}
 
 	if c.Debug {
 		cres.print()
 	}
 
-	return cres, nil
+	return cres.toResponse(), nil
+}
+
+func (c *Client) newRequest(messages []*llm.Message) *ChatRequest {
+	creq := &ChatRequest{
+		Model:       c.Model,
+		Messages:    make([]*Message, 0, len(messages)),
+		Temperature: c.temperature(),
+	}
+	for _, m := range messages {
+		creq.Messages = append(creq.Messages, &Message{Role: m.Role, Content: m.Content})
+	}
+	return creq
+}
+
+func (c *Client) send(ctx context.Context, creq *ChatRequest) (*http.Response, error) {
+	if c.Debug {
+		creq.print()
+	}
+	body, err := json.Marshal(creq)
+	if err != nil {
+		return nil, err
+	}
+
+	// The timeout applies to each attempt, including reading a streamed answer.
+	client := &http.Client{
+		Timeout: c.timeout(),
+	}
+	return c.retryPolicy().Do(ctx, client, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodPost,
+			c.endpoint(),
+			bytes.NewReader(body),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		c.setAuth(req)
+		return req, nil
+	}, parseError)
+}
+
+func (r *ChatResponse) toResponse() *llm.Response {
+	res := &llm.Response{Content: r.Choices[0].Message.Content}
+	if r.Usage != nil {
+		res.Usage = llm.Usage{
+			PromptTokens:     r.Usage.PromptTokens,
+			CompletionTokens: r.Usage.CompletionTokens,
+		}
+	}
+	return res
 }
 
 func (r *ChatRequest) print() {
-	fmt.Printf("\n## Chat Request\n")
-	fmt.Println("### Model")
-	fmt.Println(r.Model)
-	fmt.Println("### Prompts")
+	fmt.Fprintf(os.Stderr, "\n## Chat Request\n")
+	fmt.Fprintln(os.Stderr, "### Model")
+	fmt.Fprintln(os.Stderr, r.Model)
+	fmt.Fprintln(os.Stderr, "### Prompts")
 	for _, m := range r.Messages {
-		fmt.Printf("- %s \n%s\n", m.Role, m.Content)
+		fmt.Fprintf(os.Stderr, "- %s \n%s\n", m.Role, m.Content)
 	}
 }
 
 func (r *ChatResponse) print() {
-	fmt.Printf("\n## Chat Response\n")
-	fmt.Printf("### Choice\n%s\n", r.Choices[0].Message.Content)
-	fmt.Printf(
+	fmt.Fprintf(os.Stderr, "\n## Chat Response\n")
+	fmt.Fprintf(os.Stderr, "### Choice\n%s\n", r.Choices[0].Message.Content)
+	if r.Usage == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr,
 		"\n### Usages\ntotal: %d (prompt: %d, completion: %d)\n",
 		r.Usage.TotalTokens,
 		r.Usage.PromptTokens,
 		r.Usage.CompletionTokens)
 }
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (c *Client) temperature() float64 {
+	if c.Temperature != nil {
+		return *c.Temperature
+	}
+	return llm.DefaultTemperature
+}
+
+func (c *Client) retryPolicy() llm.RetryPolicy {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	return llm.DefaultRetryPolicy
+}
+
+// parseError reads the `{"error": {...}}` body returned by OpenAI and Azure OpenAI.
+func parseError(res *http.Response) *llm.APIError {
+	apiErr := &llm.APIError{}
+	var body struct {
+		Error struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return apiErr
+	}
+	apiErr.Type = body.Error.Type
+	apiErr.Message = body.Error.Message
+	// The code is a string on OpenAI, but Azure may send a number.
+	if code := strings.Trim(string(body.Error.Code), `"`); code != "null" {
+		apiErr.Code = code
+	}
+	return apiErr
+}
@@ -0,0 +1,89 @@
+package openai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tetran/lgh/internal/llm"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *Client
+		want   string
+	}{
+		{"default", &Client{}, "https://api.openai.com/v1/chat/completions"},
+		{"compatible", &Client{BaseURL: "http://localhost:8000/v1/"}, "http://localhost:8000/v1/chat/completions"},
+		{
+			"azure",
+			&Client{BaseURL: "https://res.openai.azure.com", Deployment: "gpt4o", APIVersion: "2024-02-01"},
+			"https://res.openai.azure.com/openai/deployments/gpt4o/chat/completions?api-version=2024-02-01",
+		},
+		{
+			"azure default version",
+			&Client{BaseURL: "https://res.openai.azure.com", Deployment: "gpt4o"},
+			"https://res.openai.azure.com/openai/deployments/gpt4o/chat/completions?api-version=" + DefaultAzureAPIVersion,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.client.endpoint(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSetAuth(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	(&Client{ApiKey: "k"}).setAuth(req)
+	if req.Header.Get("Authorization") != "Bearer k" || req.Header.Get("api-key") != "" {
+		t.Fatalf("unexpected headers for OpenAI: %v", req.Header)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "http://example.com", nil)
+	(&Client{ApiKey: "k", Deployment: "d"}).setAuth(req)
+	if req.Header.Get("api-key") != "k" || req.Header.Get("Authorization") != "" {
+		t.Fatalf("unexpected headers for Azure: %v", req.Header)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	res := &http.Response{Body: io.NopCloser(strings.NewReader(
+		`{"error": {"message": "The model does not exist", "type": "invalid_request_error", "code": "model_not_found"}}`))}
+	apiErr := parseError(res)
+	if apiErr.Type != "invalid_request_error" || apiErr.Code != "model_not_found" || apiErr.Message != "The model does not exist" {
+		t.Fatalf("unexpected error: %+v", apiErr)
+	}
+
+	res = &http.Response{Body: io.NopCloser(strings.NewReader(`{"error": {"message": "Rate limit", "code": 429}}`))}
+	if apiErr = parseError(res); apiErr.Code != "429" {
+		t.Fatalf("expected numeric code to be kept, got %+v", apiErr)
+	}
+}
+
+func TestChatBaseURL(t *testing.T) {
+	var auth, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, path = r.Header.Get("Authorization"), r.URL.Path
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "summary"}}],
+			"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}}`))
+	}))
+	defer srv.Close()
+
+	// An OpenAI-compatible server, e.g. vLLM or LiteLLM
+	c := &Client{BaseURL: srv.URL + "/v1", ApiKey: "k", Model: "local", Retry: &llm.RetryPolicy{}}
+	res, err := c.Chat(context.Background(), []*llm.Message{{Role: llm.RoleUser, Content: "diff"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/chat/completions" || auth != "Bearer k" {
+		t.Errorf("unexpected request to %s with %q", path, auth)
+	}
+	if res.Content != "summary" || res.Usage.Total() != 15 {
+		t.Errorf("unexpected response %+v", res)
+	}
+}
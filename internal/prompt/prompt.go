@@ -0,0 +1,209 @@
+// Package prompt renders the prompts lgh sends to the model from text/template files.
+// The built-in templates can be overridden by files of the same name in the user's
+// and the repository's prompt directories.
+package prompt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Names of the templates.
+const (
+	System   = "system"
+	Overview = "overview"
+	File     = "file"
+	Merge    = "merge"
+	Commit   = "commit"
+	Reduce   = "reduce"
+	Branch   = "branch"
+	Sections = "sections"
+	Message  = "message"
+	PR       = "pr"
+	Release  = "release"
+)
+
+// Ext is the extension of template files.
+const Ext = ".tmpl"
+
+//go:embed defaults/*.tmpl
+var defaults embed.FS
+
+// Data is what the templates are executed with. Fields not relevant to a prompt are left empty.
+type Data struct {
+	// Lang is the full name of the output language, e.g. "English".
+	Lang string
+	// LangHint is the writing conventions of the output language, e.g. the format of dates. It may be empty.
+	LangHint string
+	Base     string
+	Target   string
+	Commit   *CommitData
+	File     *FileData
+	// Content is the text to summarize: a diff, or the summaries made by the previous step.
+	Content string
+	// Style is the style of commit messages: "conventional", or a description of the style.
+	Style string
+	// Template is the pull request template of the repository, if any.
+	Template string
+}
+
+type CommitData struct {
+	Hash    string
+	Author  string
+	Date    string
+	Subject string
+	Message string
+	Files   []*FileData
+}
+
+type FileData struct {
+	Path string
+	// Status is ADD, MOD or DEL.
+	Status string
+	// Summary is set once the file has been summarized.
+	Summary string
+}
+
+// Set is the templates in effect.
+type Set struct {
+	templates map[string]*template.Template
+	sources   map[string]string
+	// origins tells where each template comes from: a file path, or "default".
+	origins map[string]string
+}
+
+// Names returns the names of all templates, sorted.
+func Names() []string {
+	entries, _ := defaults.ReadDir("defaults")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), Ext))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the source of a built-in template.
+func Default(name string) (string, error) {
+	b, err := defaults.ReadFile("defaults/" + name + Ext)
+	if err != nil {
+		return "", fmt.Errorf("unknown prompt template: %s", name)
+	}
+	return string(b), nil
+}
+
+// Load reads the built-in templates and overrides them with the files found in dirs,
+// later directories taking precedence. Missing directories are skipped.
+// Every template is tried once with sample data, so mistakes are reported before any request is sent.
+func Load(dirs ...string) (*Set, error) {
+	s := &Set{
+		templates: map[string]*template.Template{},
+		sources:   map[string]string{},
+		origins:   map[string]string{},
+	}
+	for _, name := range Names() {
+		src, err := Default(name)
+		if err != nil {
+			return nil, err
+		}
+		s.sources[name] = src
+		s.origins[name] = "default"
+	}
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || filepath.Ext(e.Name()) != Ext {
+				continue
+			}
+			name := strings.TrimSuffix(e.Name(), Ext)
+			path := filepath.Join(dir, e.Name())
+			if _, ok := s.sources[name]; !ok {
+				return nil, fmt.Errorf("unknown prompt template %s (available: %s)", path, strings.Join(Names(), ", "))
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			s.sources[name] = string(b)
+			s.origins[name] = path
+		}
+	}
+
+	for name, src := range s.sources {
+		t, err := template.New(name).Option("missingkey=error").Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("prompt template %s: %w", s.origins[name], err)
+		}
+		s.templates[name] = t
+		if _, err = s.Render(name, sample); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Render executes the named template. Leading and trailing white space is removed.
+func (s *Set) Render(name string, data *Data) (string, error) {
+	t, ok := s.templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt template: %s", name)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("prompt template %s: %w", s.origins[name], err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Origin tells where the named template comes from: a file path, or "default".
+func (s *Set) Origin(name string) string {
+	return s.origins[name]
+}
+
+// Version is a hash of all the templates in effect. It changes whenever any template changes,
+// so it is part of the cache keys of the summaries.
+func (s *Set) Version() string {
+	h := sha256.New()
+	for _, name := range Names() {
+		fmt.Fprintf(h, "%s\x00%s\x00", name, s.sources[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// sample fills every field, so that trying a template with it reaches all of its actions
+// except those in conditional branches.
+var sample = func() *Data {
+	file := &FileData{Path: "main.go", Status: "MOD", Summary: "* Change main"}
+	return &Data{
+		Lang:     "English",
+		LangHint: "Write dates as YYYY-MM-DD.",
+		Base:     "main",
+		Target:   "feature",
+		Commit: &CommitData{
+			Hash:    "0000000000000000000000000000000000000000",
+			Author:  "lgh <lgh@example.com>",
+			Date:    "Mon Jan 1 00:00:00 2024 +0000",
+			Subject: "Change main",
+			Message: "Change main",
+			Files:   []*FileData{file},
+		},
+		File:     file,
+		Content:  "content",
+		Style:    "conventional",
+		Template: "## Summary",
+	}
+}()
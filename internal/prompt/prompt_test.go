@@ -0,0 +1,86 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Render(File, &Data{Lang: "Japanese", Content: "diff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "# Instruction:") {
+		t.Errorf("the comment should be trimmed: %q", out)
+	}
+	if !strings.Contains(out, "Preferred language is Japanese.") || !strings.HasSuffix(out, "diff") {
+		t.Errorf("unexpected prompt: %q", out)
+	}
+}
+
+func TestLoadOverride(t *testing.T) {
+	user, repo := t.TempDir(), t.TempDir()
+	write(t, user, "commit.tmpl", "user {{.Commit.Subject}}")
+	write(t, user, "branch.tmpl", "user branch")
+	write(t, repo, "branch.tmpl", "repo {{.Base}}..{{.Target}}")
+
+	def, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(user, repo, filepath.Join(repo, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version() == def.Version() {
+		t.Error("the version should change with the templates")
+	}
+
+	out, _ := s.Render(Commit, &Data{Commit: &CommitData{Subject: "Fix bug"}})
+	if out != "user Fix bug" {
+		t.Errorf("unexpected commit prompt: %q", out)
+	}
+	out, _ = s.Render(Branch, &Data{Base: "main", Target: "feat"})
+	if out != "repo main..feat" {
+		t.Errorf("unexpected branch prompt: %q", out)
+	}
+	if got := s.Origin(Branch); got != filepath.Join(repo, "branch.tmpl") {
+		t.Errorf("unexpected origin: %s", got)
+	}
+	if got := s.Origin(File); got != "default" {
+		t.Errorf("unexpected origin: %s", got)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		file   string
+		source string
+		want   string
+	}{
+		{"unknown.tmpl", "x", "unknown prompt template"},
+		{"file.tmpl", "{{.Nope}}", "can't evaluate field Nope"},
+		{"commit.tmpl", "{{end}}", "unexpected"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		write(t, dir, tt.file, tt.source)
+		_, err := Load(dir)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q, got %v", tt.file, tt.want, err)
+		}
+	}
+}
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,91 @@
+// Package report defines the structured (JSON) output of branch-summary and its schema.
+package report
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+)
+
+// Schema is the JSON Schema of BranchSummary, also published in the repository as branch-summary.schema.json.
+//
+//go:embed branch-summary.schema.json
+var Schema []byte
+
+type BranchSummary struct {
+	Base      string    `json:"base"`
+	Target    string    `json:"target"`
+	MergeBase string    `json:"merge_base"`
+	Commits   []Commit  `json:"commits"`
+	Sections  []Section `json:"sections"`
+	Usage     Usage     `json:"usage"`
+}
+
+type Commit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+	Merge   bool   `json:"merge"`
+	Files   []File `json:"files"`
+	Summary string `json:"summary"`
+}
+
+type File struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+	Summary string `json:"summary"`
+}
+
+type Section struct {
+	Title string   `json:"title"`
+	Items []string `json:"items"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// SectionsSchema is the schema the model's answer must follow for the final summary.
+// It is sent to providers which support structured output, and the answers of the others are
+// validated against it. It is built from the section definition of Schema, so the two can't differ.
+var SectionsSchema = sectionsSchema()
+
+func sectionsSchema() json.RawMessage {
+	var root struct {
+		Defs map[string]json.RawMessage `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema, &root); err != nil {
+		panic(err)
+	}
+	b, err := json.Marshal(map[string]any{
+		"type":                 "object",
+		"required":             []string{"sections"},
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"sections": map[string]any{"type": "array", "items": root.Defs["section"]},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Marshal validates the summary against Schema and encodes it.
+func (s *BranchSummary) Marshal() ([]byte, error) {
+	// Author addresses are kept readable instead of escaping < and >.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	if err := Validate(Schema, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	s := &BranchSummary{
+		Base:      "main",
+		Target:    "feature",
+		MergeBase: "abc",
+		Commits: []Commit{{
+			Hash:    "def",
+			Subject: "Add feature",
+			Files:   []File{{Path: "main.go", Status: "ADD", Summary: "* Add main"}},
+			Summary: "* Add feature",
+		}},
+		Sections: []Section{{Title: "Add feature", Items: []string{"details"}}},
+		Usage:    Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}
+	if _, err := s.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Commits[0].Files[0].Status = "RENAME"
+	s.Sections[0].Title = ""
+	_, err := s.Marshal()
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	for _, want := range []string{`$.commits[0].files[0].status: "RENAME" is not one of`, "$.sections[0].title: shorter than 1"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %q", want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema := []byte(`{"type": "object", "required": ["n"], "additionalProperties": false,
+		"properties": {"n": {"type": "integer", "minimum": 0}}}`)
+
+	tests := []struct {
+		doc  string
+		want string
+	}{
+		{`{"n": 1}`, ""},
+		{`{"n": 1.5}`, "$.n: expected integer, got number"},
+		{`{"n": -1}`, "$.n: less than 0"},
+		{`{}`, `$: missing required property "n"`},
+		{`{"n": 1, "x": 2}`, `$: unexpected property "x"`},
+		{`[]`, "$: expected object, got array"},
+	}
+	for _, tt := range tests {
+		err := Validate(schema, []byte(tt.doc))
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.doc, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q, got %v", tt.doc, tt.want, err)
+		}
+	}
+}
+
+func TestSectionsSchema(t *testing.T) {
+	if err := Validate(SectionsSchema, []byte(`{"sections": [{"title": "Features", "items": ["Add X"]}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	err := Validate(SectionsSchema, []byte(`{"sections": [{"title": "", "items": []}]}`))
+	if err == nil || !strings.Contains(err.Error(), "$.sections[0].title: shorter than 1") {
+		t.Errorf("expected the empty title to be rejected, got %v", err)
+	}
+}
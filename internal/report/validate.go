@@ -0,0 +1,155 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validate checks the JSON document against the JSON Schema.
+// It supports the subset of JSON Schema used by lgh's schemas: type, properties, required,
+// additionalProperties, items, enum, minimum, minLength and local $ref into $defs.
+func Validate(schema, document []byte) error {
+	var root map[string]any
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	var doc any
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	v := &validator{root: root}
+	v.validate(root, doc, "$")
+	if len(v.errs) > 0 {
+		return fmt.Errorf("schema validation failed: %s", strings.Join(v.errs, "; "))
+	}
+	return nil
+}
+
+type validator struct {
+	root map[string]any
+	errs []string
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) validate(schema map[string]any, value any, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, ok := v.resolve(ref)
+		if !ok {
+			v.fail(path, "unresolvable $ref %s", ref)
+			return
+		}
+		schema = resolved
+	}
+
+	if t, ok := schema["type"].(string); ok && !hasType(value, t) {
+		v.fail(path, "expected %s, got %s", t, typeOf(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "%#v is not one of %v", value, enum)
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		v.validateObject(schema, val, path)
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case string:
+		if min, ok := schema["minLength"].(float64); ok && float64(utf8.RuneCountInString(val)) < min {
+			v.fail(path, "shorter than %v characters", min)
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && val < min {
+			v.fail(path, "less than %v", min)
+		}
+	}
+}
+
+func (v *validator) validateObject(schema map[string]any, obj map[string]any, path string) {
+	props, _ := schema["properties"].(map[string]any)
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if _, ok := obj[r.(string)]; !ok {
+				v.fail(path, "missing required property %q", r)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if ps, ok := props[k].(map[string]any); ok {
+			v.validate(ps, obj[k], path+"."+k)
+		} else if ap, ok := schema["additionalProperties"].(bool); ok && !ap {
+			v.fail(path, "unexpected property %q", k)
+		}
+	}
+}
+
+func (v *validator) resolve(ref string) (map[string]any, bool) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+	var node any = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		node = m[part]
+	}
+	m, ok := node.(map[string]any)
+	return m, ok
+}
+
+func hasType(value any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return typeOf(value) == t
+}
+
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
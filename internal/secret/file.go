@@ -0,0 +1,176 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// kdfIterations is the PBKDF2 cost of new files, following the OWASP recommendation for HMAC-SHA256.
+// The cost is stored in the file, so it can be raised without breaking existing files.
+var kdfIterations = 600000
+
+// File keeps the secrets in a file encrypted with AES-256-GCM, under a key derived from
+// a passphrase with PBKDF2. It is meant for machines without a secret store, such as servers and CI.
+type File struct {
+	Path string
+	// Passphrase is asked for when the file is read or written.
+	Passphrase func() (string, error)
+}
+
+// encryptedFile is the content of the file. The salt is renewed on every write.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func (f *File) Get(name string) (string, error) {
+	secrets, _, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (f *File) Set(name, value string) error {
+	secrets, passphrase, err := f.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return f.save(secrets, passphrase)
+}
+
+func (f *File) Delete(name string) error {
+	secrets, passphrase, err := f.load()
+	if err != nil {
+		return err
+	}
+	delete(secrets, name)
+	return f.save(secrets, passphrase)
+}
+
+// load decrypts the file. A missing file holds no secrets.
+func (f *File) load() (map[string]string, string, error) {
+	passphrase, err := f.Passphrase()
+	if err != nil {
+		return nil, "", err
+	}
+	secrets := map[string]string{}
+
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, passphrase, nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	var ef encryptedFile
+	if err = json.Unmarshal(b, &ef); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", f.Path, err)
+	}
+	if ef.Version != 1 {
+		return nil, "", fmt.Errorf("%s: unsupported version %d", f.Path, ef.Version)
+	}
+	gcm, err := newGCM(passphrase, ef.Salt, ef.Iterations)
+	if err != nil {
+		return nil, "", err
+	}
+	plain, err := gcm.Open(nil, ef.Nonce, ef.Data, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: wrong passphrase or corrupted file", f.Path)
+	}
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", f.Path, err)
+	}
+	return secrets, passphrase, nil
+}
+
+func (f *File) save(secrets map[string]string, passphrase string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	ef := encryptedFile{Version: 1, Iterations: kdfIterations, Salt: make([]byte, 16)}
+	if _, err = rand.Read(ef.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(passphrase, ef.Salt, ef.Iterations)
+	if err != nil {
+		return err
+	}
+	ef.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(ef.Nonce); err != nil {
+		return err
+	}
+	ef.Data = gcm.Seal(nil, ef.Nonce, plain, nil)
+
+	b, err := json.MarshalIndent(ef, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("the passphrase is empty")
+	}
+	block, err := aes.NewCipher(pbkdf2([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key with PBKDF2-HMAC-SHA256 (RFC 8018).
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	size := prf.Size()
+	blocks := (keyLen + size - 1) / size
+
+	key := make([]byte, 0, blocks*size)
+	var counter [4]byte
+	for i := 1; i <= blocks; i++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(i))
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+
+		t := make([]byte, size)
+		copy(t, u)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,116 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Service is the name the secrets are stored under in the system secret store.
+const Service = "lgh"
+
+// Keyring is the system secret store, used through its command line tool:
+// secret-tool (Secret Service, e.g. GNOME Keyring or KWallet) on Linux and security (Keychain) on macOS.
+type Keyring struct{}
+
+// probeTimeout limits the look-up KeyringAvailable makes. Without a session bus,
+// secret-tool may wait for one for a long time.
+const probeTimeout = 3 * time.Second
+
+// KeyringAvailable reports whether the system secret store can be used: its command line tool
+// is installed and answers a look-up, which fails e.g. on a headless machine without a D-Bus session.
+func KeyringAvailable() bool {
+	if _, err := exec.LookPath(keyringTool()); err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	_, err := get(ctx, "probe")
+	return err == nil || errors.Is(err, ErrNotFound)
+}
+
+func keyringTool() string {
+	if runtime.GOOS == "darwin" {
+		return "security"
+	}
+	return "secret-tool"
+}
+
+func (Keyring) Get(name string) (string, error) {
+	return get(context.Background(), name)
+}
+
+func get(ctx context.Context, name string) (string, error) {
+	var out []byte
+	var err error
+	if runtime.GOOS == "darwin" {
+		out, err = run(ctx, nil, "security", "find-generic-password", "-s", Service, "-a", name, "-w")
+	} else {
+		out, err = run(ctx, nil, "secret-tool", "lookup", "service", Service, "account", name)
+	}
+	if err != nil {
+		// Both tools fail without a message when nothing matches.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) == 0 {
+			return "", ErrNotFound
+		}
+		if runtime.GOOS == "darwin" && strings.Contains(err.Error(), "could not be found") {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	value := strings.TrimRight(string(out), "\r\n")
+	if value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (Keyring) Set(name, value string) error {
+	// Both tools read the secret from stdin, so it doesn't show up in the process list:
+	// security in its interactive mode, where the command is a line of input.
+	if runtime.GOOS == "darwin" {
+		// -U updates the item if it exists.
+		line := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", securityQuote(Service), securityQuote(name), securityQuote(value))
+		_, err := run(context.Background(), strings.NewReader(line), "security", "-i")
+		return err
+	}
+	_, err := run(context.Background(), strings.NewReader(value), "secret-tool", "store", "--label", Service+" "+name, "service", Service, "account", name)
+	return err
+}
+
+func (Keyring) Delete(name string) error {
+	var err error
+	if runtime.GOOS == "darwin" {
+		_, err = run(context.Background(), nil, "security", "delete-generic-password", "-s", Service, "-a", name)
+	} else {
+		_, err = run(context.Background(), nil, "secret-tool", "clear", "service", Service, "account", name)
+	}
+	return err
+}
+
+// securityQuote quotes an argument of a command given to `security -i`.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func run(ctx context.Context, stdin *strings.Reader, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
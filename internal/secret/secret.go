@@ -0,0 +1,42 @@
+// Package secret keeps API keys out of the configuration file: in the system secret store,
+// in a passphrase-encrypted file, or behind a command which prints them.
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotFound is returned when the store has no secret of the name.
+var ErrNotFound = errors.New("secret not found")
+
+// Store keeps secrets by name.
+type Store interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+// Command runs the shell command and returns what it prints, without the trailing new line,
+// e.g. `pass show openai` or `op read op://vault/openai/key`.
+func Command(ctx context.Context, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("`%s` failed: %w: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("`%s` failed: %w", command, err)
+	}
+	value := strings.TrimRight(string(out), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("`%s` printed nothing", command)
+	}
+	return value, nil
+}
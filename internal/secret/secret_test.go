@@ -0,0 +1,124 @@
+package secret
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// Test vectors of PBKDF2-HMAC-SHA256 from RFC 7914, section 11.
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, 32))
+		if got != tt.want {
+			t.Errorf("pbkdf2(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	defer func(n int) { kdfIterations = n }(kdfIterations)
+	kdfIterations = 1000
+
+	path := filepath.Join(t.TempDir(), "secrets")
+	passphrase := "correct horse"
+	f := &File{Path: path, Passphrase: func() (string, error) { return passphrase, nil }}
+
+	if _, err := f.Get("openai-api-key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := f.Set("openai-api-key", "sk-123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("anthropic-api-key", "sk-ant-456"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := f.Get("openai-api-key"); err != nil || v != "sk-123" {
+		t.Fatalf("unexpected value %q, %v", v, err)
+	}
+	if err := f.Delete("openai-api-key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Get("openai-api-key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if v, _ := f.Get("anthropic-api-key"); v != "sk-ant-456" {
+		t.Fatalf("unexpected value %q", v)
+	}
+
+	passphrase = "wrong"
+	if _, err := f.Get("anthropic-api-key"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("expected a passphrase error, got %v", err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	v, err := Command(context.Background(), "printf 'sk-123\\n'")
+	if err != nil || v != "sk-123" {
+		t.Fatalf("unexpected value %q, %v", v, err)
+	}
+	if _, err = Command(context.Background(), "echo oops >&2; exit 3"); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatalf("expected the error output, got %v", err)
+	}
+	if _, err = Command(context.Background(), "true"); err == nil {
+		t.Fatal("expected an error for an empty output")
+	}
+}
+
+func TestKeyringAvailable(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("the probe runs security on macOS")
+	}
+	tests := []struct {
+		script string
+		want   bool
+	}{
+		// Nothing matches the look-up.
+		{"exit 1", true},
+		{"echo sk-123", true},
+		// No D-Bus session, as on a headless machine
+		{"echo 'Cannot autolaunch D-Bus without X11 $DISPLAY' >&2; exit 1", false},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte("#!/bin/sh\n"+tt.script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PATH", dir)
+		if got := KeyringAvailable(); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.script, got, tt.want)
+		}
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if KeyringAvailable() {
+		t.Error("expected no keyring without secret-tool")
+	}
+}
+
+func TestSecurityQuote(t *testing.T) {
+	tests := map[string]string{
+		"sk-123":     `"sk-123"`,
+		`a"b`:        `"a\"b"`,
+		`a\b`:        `"a\\b"`,
+		"with space": `"with space"`,
+	}
+	for s, want := range tests {
+		if got := securityQuote(s); got != want {
+			t.Errorf("%s: got %s, want %s", s, got, want)
+		}
+	}
+}
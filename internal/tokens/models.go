@@ -0,0 +1,74 @@
+package tokens
+
+import "strings"
+
+// Model describes the limits and prices of a model.
+type Model struct {
+	// ContextWindow is the number of tokens the model accepts in a request, including the completion.
+	ContextWindow int
+	// InputPrice and OutputPrice are USD per 1M tokens. Both are zero when the price is unknown.
+	InputPrice  float64
+	OutputPrice float64
+}
+
+// PriceKnown reports whether the cost of the model can be estimated.
+func (m Model) PriceKnown() bool {
+	return m.InputPrice > 0 || m.OutputPrice > 0
+}
+
+// Cost returns the cost in USD of the given tokens.
+func (m Model) Cost(prompt, completion int) float64 {
+	return (float64(prompt)*m.InputPrice + float64(completion)*m.OutputPrice) / 1e6
+}
+
+// DefaultContextWindow is assumed for models not in the table.
+const DefaultContextWindow = 8192
+
+// models is matched by the longest prefix of the model name, so that dated
+// snapshots such as gpt-4o-2024-08-06 share the entry of their family.
+var models = map[string]Model{
+	"gpt-3.5-turbo": {16385, 0.5, 1.5},
+	"gpt-4":         {8192, 30, 60},
+	"gpt-4-32k":     {32768, 60, 120},
+	"gpt-4-turbo":   {128000, 10, 30},
+	"gpt-4o":        {128000, 2.5, 10},
+	"gpt-4o-mini":   {128000, 0.15, 0.6},
+	"gpt-4.1":       {1047576, 2, 8},
+	"gpt-4.1-mini":  {1047576, 0.4, 1.6},
+	"gpt-4.1-nano":  {1047576, 0.1, 0.4},
+	"o1":            {200000, 15, 60},
+	"o1-mini":       {128000, 1.1, 4.4},
+	"o3-mini":       {200000, 1.1, 4.4},
+
+	"claude-3-haiku":    {200000, 0.25, 1.25},
+	"claude-3-sonnet":   {200000, 3, 15},
+	"claude-3-opus":     {200000, 15, 75},
+	"claude-3-5-haiku":  {200000, 0.8, 4},
+	"claude-3-5-sonnet": {200000, 3, 15},
+	"claude-3-7-sonnet": {200000, 3, 15},
+	"claude-sonnet-4":   {200000, 3, 15},
+	"claude-opus-4":     {200000, 15, 75},
+
+	// Local models are free to run; only their context window matters.
+	"llama3":   {8192, 0, 0},
+	"llama3.1": {131072, 0, 0},
+	"llama3.2": {131072, 0, 0},
+	"mistral":  {32768, 0, 0},
+	"qwen2.5":  {32768, 0, 0},
+	"gemma2":   {8192, 0, 0},
+}
+
+// Lookup returns the model information, falling back to DefaultContextWindow and an unknown price.
+func Lookup(model string) Model {
+	m := strings.ToLower(model)
+	best := ""
+	for name := range models {
+		if strings.HasPrefix(m, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Model{ContextWindow: DefaultContextWindow}
+	}
+	return models[best]
+}
@@ -0,0 +1,37 @@
+package tokens
+
+import "testing"
+
+func TestCount(t *testing.T) {
+	tok := ForModel("gpt-4")
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 2},
+		{"Hello, world!", 4},
+		{"1234567", 3},
+		{"こんにちは", 6},
+	}
+	for _, tt := range tests {
+		if got := tok.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q): expected %d, got %d", tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if m := Lookup("gpt-4o-mini-2024-07-18"); m.InputPrice != 0.15 {
+		t.Fatalf("expected the gpt-4o-mini entry, got %+v", m)
+	}
+	if m := Lookup("gpt-4o-2024-08-06"); m.InputPrice != 2.5 {
+		t.Fatalf("expected the gpt-4o entry, got %+v", m)
+	}
+	if m := Lookup("my-finetune"); m.ContextWindow != DefaultContextWindow || m.PriceKnown() {
+		t.Fatalf("expected the default entry, got %+v", m)
+	}
+	if c := Lookup("gpt-4o").Cost(1_000_000, 100_000); c != 3.5 {
+		t.Fatalf("expected $3.5, got %v", c)
+	}
+}